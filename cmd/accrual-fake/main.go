@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	accrualfake "github.com/kontik-pk/go-musthave-diploma-tpl/internal/accrual-fake"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/logger"
+	"net/http"
+	"os"
+)
+
+const logLevel = "info"
+
+func main() {
+	log, err := logger.New(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	var address, scenarioPath string
+	flag.StringVar(&address, "a", "localhost:8081", "address and port to run fake accrual system")
+	flag.StringVar(&scenarioPath, "s", "", "path to json file with scenario")
+	flag.Parse()
+	if envRunAddr := os.Getenv("RUN_ADDRESS"); envRunAddr != "" {
+		address = envRunAddr
+	}
+	if envScenario := os.Getenv("ACCRUAL_FAKE_SCENARIO"); envScenario != "" {
+		scenarioPath = envScenario
+	}
+
+	var scenario accrualfake.Scenario
+	if scenarioPath != "" {
+		if scenario, err = accrualfake.LoadScenario(scenarioPath); err != nil {
+			log.Sugar().Errorf("error while loading scenario: %s", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	log.Sugar().Infof("Starting fake accrual system on addr: %s", address)
+	if err = http.ListenAndServe(address, accrualfake.New(scenario)); err != nil {
+		log.Sugar().Errorf("error while running fake accrual system: %s", err.Error())
+		os.Exit(1)
+	}
+}
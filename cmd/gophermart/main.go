@@ -3,21 +3,42 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/compress"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/flags"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/handlers"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/logger"
 	loyalty_system "github.com/kontik-pk/go-musthave-diploma-tpl/internal/loyalty-system"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/notify"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/oidc"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/router"
 	runner2 "github.com/kontik-pk/go-musthave-diploma-tpl/internal/runner"
 	server "github.com/kontik-pk/go-musthave-diploma-tpl/internal/server"
+	"go.uber.org/zap"
+	"math"
 	"os"
+	"strings"
+	"time"
 )
 
-const logLevel = "info"
+const (
+	logLevel             = "info"
+	oidcDiscoveryTimeout = 30 * time.Second
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "roles" {
+		os.Exit(roles(os.Args[2:]))
+	}
+
 	ctx := context.Background()
 	log, err := logger.New(logLevel)
 	if err != nil {
@@ -27,10 +48,36 @@ func main() {
 
 	params := flags.Init(
 		flags.WithAddr(),
+		flags.WithCompression(),
 		flags.WithDatabase(),
 		flags.WithAccrual(),
+		flags.WithAccrualWorkers(),
+		flags.WithAccrualTimeout(),
+		flags.WithJWTKeys(),
+		flags.WithQueryToken(),
+		flags.WithPasswordPolicy(),
+		flags.WithPasswordHashing(),
+		flags.WithOIDC(),
 	)
 
+	keys, err := loadKeyring(params.Auth.KeysFile, params.Auth.Keys, log.Sugar())
+	if err != nil {
+		log.Sugar().Errorf("error while loading jwt signing keys: %s", err.Error())
+		os.Exit(1)
+	}
+
+	passwords, err := loadPasswordPolicy(params.Auth.PasswordMinLength, params.Auth.PasswordDenyList)
+	if err != nil {
+		log.Sugar().Errorf("error while loading password policy: %s", err.Error())
+		os.Exit(1)
+	}
+
+	passwordHasher, err := newPasswordHasher(params)
+	if err != nil {
+		log.Sugar().Errorf("error while configuring password hashing: %s", err.Error())
+		os.Exit(1)
+	}
+
 	db, err := sql.Open("pgx", params.Database.ConnectionString)
 	if err != nil {
 		log.Sugar().Errorf("error while init db: %s", err.Error())
@@ -42,14 +89,51 @@ func main() {
 			os.Exit(1)
 		}
 	}()
-	dbManager, err := database.New(ctx, db)
+	dbManager, err := database.New(ctx, db, database.WithPasswordHasher(passwordHasher), database.WithLogger(log.Sugar()))
 	if err != nil {
 		log.Sugar().Errorf("error while init db: %s", err.Error())
 		os.Exit(1)
 	}
+	if err = dbManager.MigrateUp(ctx); err != nil {
+		log.Sugar().Errorf("error while applying migrations: %s", err.Error())
+		os.Exit(1)
+	}
 
-	appServer := server.New(params.Server.Address, router.New(dbManager, log.Sugar()))
-	loyaltyPointsSystem := loyalty_system.New(params.AccrualSystem.Address, dbManager, log.Sugar())
+	loyaltyPointsSystem := loyalty_system.New(
+		loyalty_system.NewHTTPClient(params.AccrualSystem.Address, log.Sugar()),
+		params.AccrualSystem.Workers,
+		params.AccrualSystem.RequestTimeout,
+		dbManager,
+		log.Sugar(),
+	)
+	handlerOptions := []handlers.Option{
+		handlers.WithPasswordPolicy(passwords),
+		handlers.WithNotifier(notify.NewLogNotifier(log.Sugar())),
+	}
+	if params.Auth.QueryTokenParam != "" {
+		log.Sugar().Warnf("access tokens are accepted from the %q query parameter", params.Auth.QueryTokenParam)
+		handlerOptions = append(handlerOptions, handlers.WithQueryToken(params.Auth.QueryTokenParam))
+	}
+	if params.Auth.OIDC.Issuer != "" {
+		provider, err := newOIDCProvider(ctx, params)
+		if err != nil {
+			log.Sugar().Errorf("error while configuring single sign-on: %s", err.Error())
+			os.Exit(1)
+		}
+		log.Sugar().Infof("single sign-on with %q is enabled", provider.Issuer())
+		handlerOptions = append(handlerOptions, handlers.WithOIDC(provider))
+	}
+	appServer := server.New(params.Server.Address, router.New(
+		dbManager,
+		keys,
+		loyaltyPointsSystem,
+		compress.New(
+			compress.WithMinSize(params.Compression.MinSize),
+			compress.WithContentTypes(strings.Split(params.Compression.ContentTypes, ",")...),
+		),
+		log.Sugar(),
+		handlerOptions...,
+	))
 
 	runner := runner2.New(appServer, loyaltyPointsSystem, log.Sugar())
 	if err = runner.Run(ctx); err != nil {
@@ -57,3 +141,66 @@ func main() {
 		return
 	}
 }
+
+func loadKeyring(path string, inline string, log *zap.SugaredLogger) (*auth.Keyring, error) {
+	if path == "" && inline == "" {
+		log.Warn("no jwt signing keys configured, using an ephemeral key: tokens will not survive a restart")
+		return auth.NewEphemeralKeyring()
+	}
+	keys, err := auth.LoadKeyring(path, inline)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("jwt tokens are signed with key %q", keys.SigningKeyID())
+	return keys, nil
+}
+
+func loadPasswordPolicy(minLength int, denyListPath string) (*auth.PasswordPolicy, error) {
+	if denyListPath == "" {
+		return auth.NewPasswordPolicy(minLength, nil)
+	}
+	f, err := os.Open(denyListPath)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening password deny-list: %w", err)
+	}
+	defer f.Close()
+	return auth.NewPasswordPolicy(minLength, f)
+}
+
+// newPasswordHasher hashes new passwords with the configured algorithm and keeps verifying
+// the other one, so switching algorithms upgrades hashes on login instead of locking users out.
+func newPasswordHasher(params *models.Config) (*auth.PasswordHasher, error) {
+	hash := params.Auth.PasswordHash
+	if hash.Argon2Memory > math.MaxUint32 || hash.Argon2Iterations > math.MaxUint32 || hash.Argon2Parallelism > math.MaxUint8 {
+		return nil, fmt.Errorf("%w: argon2id parameters are out of range", auth.ErrInvalidHasher)
+	}
+	argon2id := auth.DefaultArgon2idHasher
+	argon2id.Memory = uint32(hash.Argon2Memory)
+	argon2id.Iterations = uint32(hash.Argon2Iterations)
+	argon2id.Parallelism = uint8(hash.Argon2Parallelism)
+	bcrypt := auth.BcryptHasher{Cost: hash.BcryptCost}
+	switch hash.Algorithm {
+	case "argon2id":
+		return auth.NewPasswordHasher(argon2id, bcrypt)
+	case "bcrypt":
+		return auth.NewPasswordHasher(bcrypt, argon2id)
+	default:
+		return nil, fmt.Errorf("%w: unknown algorithm %q", auth.ErrInvalidHasher, hash.Algorithm)
+	}
+}
+
+func newOIDCProvider(ctx context.Context, params *models.Config) (*oidc.Provider, error) {
+	config := params.Auth.OIDC
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc client id and redirect url are required")
+	}
+	ctx, cancel := context.WithTimeout(ctx, oidcDiscoveryTimeout)
+	defer cancel()
+	return oidc.New(ctx, oidc.Config{
+		Issuer:       config.Issuer,
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  config.RedirectURL,
+		Scopes:       strings.Fields(config.Scopes),
+	})
+}
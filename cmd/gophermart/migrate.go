@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/flags"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/logger"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: gophermart migrate up|down|status [-d connection string] [-n steps]"
+
+func migrate(args []string) int {
+	ctx := context.Background()
+	log, err := logger.New(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	action := args[0]
+	steps := flag.Int("n", 1, "number of migrations to revert with down")
+	params := flags.InitArgs(args[1:], flags.WithDatabase())
+
+	db, err := sql.Open("pgx", params.Database.ConnectionString)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		return 1
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	dbManager, err := database.New(ctx, db)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		return 1
+	}
+
+	switch action {
+	case "up":
+		err = dbManager.MigrateUp(ctx)
+	case "down":
+		err = dbManager.MigrateDown(ctx, *steps)
+	case "status":
+		err = printMigrationStatus(ctx, dbManager)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err != nil {
+		log.Sugar().Errorf("error while running migrate %s: %s", action, err.Error())
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus(ctx context.Context, dbManager *database.Manager) error {
+	statuses, err := dbManager.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/flags"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/logger"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"os"
+	"strings"
+)
+
+var rolesUsage = fmt.Sprintf("usage: gophermart roles grant|revoke <login> <%s> [-d connection string]", strings.Join(models.Roles, "|"))
+
+// roles manages user roles from the command line; it is how the first admin gets its role.
+func roles(args []string) int {
+	ctx := context.Background()
+	log, err := logger.New(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	if len(args) < 3 || !models.IsKnownRole(args[2]) {
+		fmt.Fprintln(os.Stderr, rolesUsage)
+		return 2
+	}
+	action, login, role := args[0], args[1], args[2]
+	params := flags.InitArgs(args[3:], flags.WithDatabase())
+
+	db, err := sql.Open("pgx", params.Database.ConnectionString)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		return 1
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	dbManager, err := database.New(ctx, db)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		return 1
+	}
+
+	switch action {
+	case "grant":
+		err = dbManager.GrantRole(login, role)
+	case "revoke":
+		err = dbManager.RevokeRole(login, role)
+	default:
+		fmt.Fprintln(os.Stderr, rolesUsage)
+		return 2
+	}
+	if err != nil {
+		log.Sugar().Errorf("error while running roles %s: %s", action, err.Error())
+		return 1
+	}
+	log.Sugar().Infof("roles %s %q for user %q is done", action, role, login)
+	return 0
+}
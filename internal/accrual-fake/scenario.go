@@ -0,0 +1,94 @@
+package accrualfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"os"
+	"strings"
+	"time"
+)
+
+var defaultProgression = []models.AccrualStatus{
+	models.AccrualStatusRegistered,
+	models.AccrualStatusProcessing,
+	models.AccrualStatusProcessed,
+}
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration should be a string like \"150ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+type Storm struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type Rule struct {
+	Prefix  string               `json:"prefix"`
+	Accrual models.Money         `json:"accrual"`
+	Status  models.AccrualStatus `json:"status,omitempty"`
+}
+
+type Scenario struct {
+	Delay         Duration               `json:"delay"`
+	FailEvery     int                    `json:"fail_every"`
+	Storms        []Storm                `json:"storms"`
+	RateLimit     int                    `json:"rate_limit"`
+	RetryAfter    int                    `json:"retry_after"`
+	RegisterAfter int                    `json:"register_after"`
+	Progression   []models.AccrualStatus `json:"progression"`
+	Rules         []Rule                 `json:"rules"`
+}
+
+func LoadScenario(path string) (Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("error while reading scenario file: %w", err)
+	}
+	var scenario Scenario
+	if err = json.Unmarshal(data, &scenario); err != nil {
+		return Scenario{}, fmt.Errorf("error while unmarshalling scenario: %w", err)
+	}
+	return scenario, nil
+}
+
+func (s Scenario) inStorm(request int) bool {
+	for _, storm := range s.Storms {
+		if request >= storm.From && request <= storm.To {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scenario) rule(orderID string) (Rule, bool) {
+	for _, rule := range s.Rules {
+		if strings.HasPrefix(orderID, rule.Prefix) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (s Scenario) status(check int) models.AccrualStatus {
+	progression := s.Progression
+	if len(progression) == 0 {
+		progression = defaultProgression
+	}
+	if check >= len(progression) {
+		return progression[len(progression)-1]
+	}
+	return progression[check]
+}
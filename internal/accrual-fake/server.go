@@ -0,0 +1,127 @@
+package accrualfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRetryAfter = 60
+
+type Server struct {
+	router   *chi.Mux
+	scenario Scenario
+
+	mu          sync.Mutex
+	requests    int
+	checks      map[string]int
+	windowStart time.Time
+	windowCount int
+}
+
+func New(scenario Scenario) *Server {
+	s := &Server{
+		scenario: scenario,
+		checks:   make(map[string]int),
+	}
+	s.router = chi.NewRouter()
+	s.router.Get("/api/orders/{number}", s.getOrder)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	if delay := time.Duration(s.scenario.Delay); delay > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+	orderID := chi.URLParam(r, "number")
+
+	s.mu.Lock()
+	s.requests++
+	request := s.requests
+	throttled := s.scenario.inStorm(request) || s.overLimit()
+	failed := !throttled && s.scenario.FailEvery > 0 && request%s.scenario.FailEvery == 0
+	var check int
+	if !throttled && !failed {
+		check = s.checks[orderID]
+		s.checks[orderID]++
+	}
+	s.mu.Unlock()
+
+	if throttled {
+		s.tooManyRequests(w)
+		return
+	}
+	if failed {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if check < s.scenario.RegisterAfter {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	info := models.AccrualInfo{
+		Order:  orderID,
+		Status: s.scenario.status(check - s.scenario.RegisterAfter),
+	}
+	if rule, ok := s.scenario.rule(orderID); ok && info.Status == models.AccrualStatusProcessed {
+		info.Accrual = rule.Accrual
+		if rule.Status != "" {
+			info.Status = rule.Status
+		}
+	}
+	body, err := json.Marshal(info)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func (s *Server) overLimit() bool {
+	if s.scenario.RateLimit <= 0 {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	s.windowCount++
+	return s.windowCount > s.scenario.RateLimit
+}
+
+func (s *Server) tooManyRequests(w http.ResponseWriter) {
+	retryAfter := s.scenario.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	limit := s.scenario.RateLimit
+	if limit <= 0 {
+		limit = 60
+	}
+	fmt.Fprintf(w, "No more than %d requests per minute allowed", limit)
+}
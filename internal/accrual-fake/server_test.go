@@ -0,0 +1,83 @@
+package accrualfake
+
+import (
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer_GetOrder(t *testing.T) {
+	t.Run("status progression with accrual rule", func(t *testing.T) {
+		srv := httptest.NewServer(New(Scenario{
+			RegisterAfter: 1,
+			Rules:         []Rule{{Prefix: "1", Accrual: 50000}},
+		}))
+		defer srv.Close()
+
+		expected := []string{
+			"",
+			`{"order":"100500","status":"REGISTERED"}`,
+			`{"order":"100500","status":"PROCESSING"}`,
+			`{"order":"100500","status":"PROCESSED","accrual":500}`,
+			`{"order":"100500","status":"PROCESSED","accrual":500}`,
+		}
+		for i, body := range expected {
+			response, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/100500", srv.URL))
+			assert.NoError(t, err)
+			if i == 0 {
+				assert.Equal(t, http.StatusNoContent, response.StatusCode())
+				continue
+			}
+			assert.Equal(t, http.StatusOK, response.StatusCode())
+			assert.Equal(t, body, response.String())
+		}
+	})
+
+	t.Run("invalid rule", func(t *testing.T) {
+		srv := httptest.NewServer(New(Scenario{
+			Progression: []models.AccrualStatus{"PROCESSED"},
+			Rules:       []Rule{{Prefix: "9", Status: "INVALID"}},
+		}))
+		defer srv.Close()
+
+		response, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/9278923470", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, `{"order":"9278923470","status":"INVALID"}`, response.String())
+	})
+
+	t.Run("429 storm and 500s", func(t *testing.T) {
+		srv := httptest.NewServer(New(Scenario{
+			Storms:     []Storm{{From: 2, To: 3}},
+			RetryAfter: 5,
+			FailEvery:  4,
+		}))
+		defer srv.Close()
+
+		expected := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusOK}
+		for _, status := range expected {
+			response, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/100500", srv.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, status, response.StatusCode())
+			if status == http.StatusTooManyRequests {
+				assert.Equal(t, "5", response.Header().Get("Retry-After"))
+				assert.Equal(t, "No more than 60 requests per minute allowed", response.String())
+			}
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		srv := httptest.NewServer(New(Scenario{RateLimit: 2}))
+		defer srv.Close()
+
+		expected := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+		for _, status := range expected {
+			response, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/100500", srv.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, status, response.StatusCode())
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyPrefix tells API keys apart from JWTs in the Authorization header
+// and makes leaked keys easy to find with secret scanners.
+const apiKeyPrefix = "gm_"
+
+// NewAPIKey returns the key id, the key in the "gm_<id>_<secret>" form shown to the user once,
+// and the hash to store server-side.
+func NewAPIKey() (string, string, string, error) {
+	idBytes, err := randomBytes(8)
+	if err != nil {
+		return "", "", "", err
+	}
+	secret, err := NewRandomToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	key := apiKeyPrefix + id + "_" + secret
+	return id, key, HashToken(key), nil
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
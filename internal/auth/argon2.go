@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// DefaultArgon2idHasher follows the OWASP recommendation of 19 MiB, 2 iterations and 1 thread.
+var DefaultArgon2idHasher = Argon2idHasher{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+type Argon2idHasher struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (h Argon2idHasher) validate() error {
+	if h.Iterations < 1 || h.Parallelism < 1 || h.SaltLength < 8 || h.KeyLength < 16 {
+		return fmt.Errorf("%w: argon2id needs at least 1 iteration, 1 thread, 8 bytes of salt and 16 bytes of key", ErrInvalidHasher)
+	}
+	if h.Memory < 8*uint32(h.Parallelism) {
+		return fmt.Errorf("%w: argon2id needs at least %d KiB of memory for %d threads", ErrInvalidHasher, 8*uint32(h.Parallelism), h.Parallelism)
+	}
+	return nil
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error while generating salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(password string, encoded string) error {
+	params, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+	actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2idHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := parseArgon2id(encoded)
+	return err != nil || params != h
+}
+
+func parseArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	var (
+		params  Argon2idHasher
+		version int
+	)
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("%w: not an argon2id hash", ErrInvalidHash)
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrInvalidHash, parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: malformed argon2id parameters %q", ErrInvalidHash, parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: malformed salt: %w", ErrInvalidHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: malformed key: %w", ErrInvalidHash, err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// BcryptHasher keeps the modular crypt format ("$2a$<cost>$...") bcrypt hashes have always
+// been stored in. Passwords longer than 72 bytes are rejected as weak instead of being silently truncated.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) validate() error {
+	if h.Cost < bcrypt.MinCost || h.Cost > bcrypt.MaxCost {
+		return fmt.Errorf("%w: bcrypt cost must be between %d and %d", ErrInvalidHasher, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", fmt.Errorf("%w: %w, need at most 72 bytes", ErrWeakPassword, ErrPasswordTooLong)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error while hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Verify(password string, encoded string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return fmt.Errorf("%w: %w", ErrInvalidHash, err)
+	}
+	return nil
+}
+
+func (h BcryptHasher) Supports(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
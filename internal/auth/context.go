@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"context"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+)
+
+type (
+	principalKey     struct{}
+	principalSinkKey struct{}
+)
+
+func ContextWithPrincipal(ctx context.Context, principal models.Principal) context.Context {
+	if sink, ok := ctx.Value(principalSinkKey{}).(*models.Principal); ok {
+		*sink = principal
+	}
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// ContextWithPrincipalSink lets a middleware that runs before authentication find out who
+// was authenticated further down the chain: the returned principal is filled in by ContextWithPrincipal.
+func ContextWithPrincipalSink(ctx context.Context) (context.Context, *models.Principal) {
+	sink := &models.Principal{}
+	return context.WithValue(ctx, principalSinkKey{}, sink), sink
+}
+
+func PrincipalFromContext(ctx context.Context) (models.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(models.Principal)
+	return principal, ok
+}
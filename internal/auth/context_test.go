@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"context"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrincipalFromContext(t *testing.T) {
+	_, ok := PrincipalFromContext(context.Background())
+	assert.False(t, ok)
+
+	principal := models.Principal{Login: "test-login", SessionID: "session-1", Roles: []string{"user"}}
+	got, ok := PrincipalFromContext(ContextWithPrincipal(context.Background(), principal))
+	assert.True(t, ok)
+	assert.Equal(t, principal, got)
+}
+
+func TestContextWithPrincipalSink(t *testing.T) {
+	ctx, sink := ContextWithPrincipalSink(context.Background())
+	assert.Empty(t, sink.Login)
+
+	principal := models.Principal{Login: "test-login", SessionID: "session-1", Roles: []string{"admin"}}
+	ContextWithPrincipal(ctx, principal)
+	assert.Equal(t, principal, *sink)
+}
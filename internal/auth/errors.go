@@ -0,0 +1,26 @@
+package auth
+
+import "errors"
+
+var (
+	ErrNoKeys        = errors.New("no signing keys configured")
+	ErrInvalidKey    = errors.New("invalid signing key")
+	ErrDuplicateKey  = errors.New("duplicate signing key id")
+	ErrUnknownKey    = errors.New("token is signed with an unknown key")
+	ErrMissingKeyID  = errors.New("token has no kid header")
+	ErrUnexpectedAlg = errors.New("unexpected signing method")
+
+	ErrWeakPassword      = errors.New("password does not satisfy the password policy")
+	ErrPasswordTooShort  = errors.New("password is too short")
+	ErrPasswordTooLong   = errors.New("password is too long")
+	ErrPasswordIsLogin   = errors.New("password must differ from the login")
+	ErrPasswordTooCommon = errors.New("password is too common")
+
+	ErrPasswordMismatch  = errors.New("password does not match the hash")
+	ErrInvalidHash       = errors.New("invalid password hash")
+	ErrUnknownHashFormat = errors.New("password hash has an unknown format")
+	ErrInvalidHasher     = errors.New("invalid password hasher parameters")
+
+	ErrInvalidTOTPSecret = errors.New("invalid totp secret")
+	ErrInvalidTOTPCode   = errors.New("invalid totp code")
+)
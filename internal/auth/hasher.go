@@ -0,0 +1,51 @@
+package auth
+
+import "fmt"
+
+// Hasher is a single password hashing algorithm with fixed parameters.
+// Hashes are encoded in the PHC string format ("$<id>$<params>$<salt>$<hash>"),
+// or in the modular crypt format bcrypt has always used.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch when the password does not match.
+	Verify(password string, encoded string) error
+	Supports(encoded string) bool
+	NeedsRehash(encoded string) bool
+}
+
+// PasswordHasher hashes new passwords with its current hasher and still verifies hashes
+// produced by the legacy ones, so the algorithm or its cost can change without a migration.
+type PasswordHasher struct {
+	hashers []Hasher
+}
+
+func NewPasswordHasher(current Hasher, legacy ...Hasher) (*PasswordHasher, error) {
+	hashers := append([]Hasher{current}, legacy...)
+	for _, h := range hashers {
+		if v, ok := h.(interface{ validate() error }); ok {
+			if err := v.validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &PasswordHasher{hashers: hashers}, nil
+}
+
+func (p *PasswordHasher) Hash(password string) (string, error) {
+	return p.hashers[0].Hash(password)
+}
+
+// Verify reports whether the hash should be replaced with a fresh one: it was produced
+// by a legacy hasher or with parameters that differ from the current ones.
+func (p *PasswordHasher) Verify(password string, encoded string) (bool, error) {
+	for i, h := range p.hashers {
+		if !h.Supports(encoded) {
+			continue
+		}
+		if err := h.Verify(password, encoded); err != nil {
+			return false, err
+		}
+		return i > 0 || h.NeedsRehash(encoded), nil
+	}
+	return false, fmt.Errorf("%w: %.10q", ErrUnknownHashFormat, encoded)
+}
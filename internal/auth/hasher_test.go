@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	encoded, err := hasher.Hash("s3cret-passw0rd")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$"))
+	assert.True(t, hasher.Supports(encoded))
+	assert.NoError(t, hasher.Verify("s3cret-passw0rd", encoded))
+	assert.ErrorIs(t, hasher.Verify("wrong-password", encoded), ErrPasswordMismatch)
+	assert.False(t, hasher.NeedsRehash(encoded))
+
+	stronger := hasher
+	stronger.Iterations = 2
+	assert.NoError(t, stronger.Verify("s3cret-passw0rd", encoded))
+	assert.True(t, stronger.NeedsRehash(encoded))
+
+	assert.ErrorIs(t, hasher.Verify("s3cret-passw0rd", "$argon2id$v=19$m=64$salt$key"), ErrInvalidHash)
+}
+
+func TestBcryptHasher_LongPassword(t *testing.T) {
+	_, err := BcryptHasher{Cost: 4}.Hash(strings.Repeat("a", 73))
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+
+	_, err = BcryptHasher{Cost: 4}.Hash(strings.Repeat("a", 72))
+	assert.NoError(t, err)
+}
+
+func TestPasswordHasher(t *testing.T) {
+	argon2id := Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	bcrypt := BcryptHasher{Cost: 4}
+	legacy, err := NewPasswordHasher(bcrypt)
+	require.NoError(t, err)
+	bcryptHash, err := legacy.Hash("s3cret-passw0rd")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(bcryptHash, "$2a$04$"))
+
+	hasher, err := NewPasswordHasher(argon2id, bcrypt)
+	require.NoError(t, err)
+	argon2idHash, err := hasher.Hash("s3cret-passw0rd")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		password       string
+		encoded        string
+		expectedRehash bool
+		expectedErr    error
+	}{
+		{
+			name:     "positive: current algorithm",
+			password: "s3cret-passw0rd",
+			encoded:  argon2idHash,
+		},
+		{
+			name:           "positive: legacy algorithm is upgraded",
+			password:       "s3cret-passw0rd",
+			encoded:        bcryptHash,
+			expectedRehash: true,
+		},
+		{
+			name:        "negative: wrong password",
+			password:    "wrong-password",
+			encoded:     bcryptHash,
+			expectedErr: ErrPasswordMismatch,
+		},
+		{
+			name:        "negative: unknown format",
+			password:    "s3cret-passw0rd",
+			encoded:     "$scrypt$ln=16,r=8,p=1$salt$key",
+			expectedErr: ErrUnknownHashFormat,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := hasher.Verify(tt.password, tt.encoded)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedRehash, rehash)
+		})
+	}
+}
+
+func TestNewPasswordHasher_InvalidParameters(t *testing.T) {
+	_, err := NewPasswordHasher(BcryptHasher{Cost: 100})
+	assert.ErrorIs(t, err, ErrInvalidHasher)
+	_, err = NewPasswordHasher(Argon2idHasher{Memory: 8, Iterations: 1, Parallelism: 4, SaltLength: 16, KeyLength: 32})
+	assert.ErrorIs(t, err, ErrInvalidHasher)
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyring_Asymmetric(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		key  Key
+		alg  string
+	}{
+		{name: "RS256", key: Key{ID: "rsa-1", Signer: rsaKey}, alg: "RS256"},
+		{name: "EdDSA", key: Key{ID: "ed-1", Signer: edKey}, alg: "EdDSA"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := NewKeyring(oldKey, tt.key)
+			require.NoError(t, err)
+			token, err := keys.Sign(claims())
+			require.NoError(t, err)
+
+			tkn, err := keys.Parse(token, &jwt.RegisteredClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, tkn.Method.Alg())
+
+			jwks := keys.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, tt.key.ID, jwks.Keys[0].KeyID)
+			assert.Equal(t, tt.alg, jwks.Keys[0].Algorithm)
+
+			_, err = jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+				return publicKeyFromJWK(t, jwks.Keys[0]), nil
+			})
+			assert.NoError(t, err, "token must be verifiable with the published jwk alone")
+		})
+	}
+
+	t.Run("negative: hmac token signed with the rsa public key", func(t *testing.T) {
+		keys, err := NewKeyring(Key{ID: "rsa-1", Signer: rsaKey})
+		require.NoError(t, err)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+		token.Header["kid"] = "rsa-1"
+		forged, err := token.SignedString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+		require.NoError(t, err)
+		_, err = keys.Parse(forged, &jwt.RegisteredClaims{})
+		assert.ErrorIs(t, err, ErrUnexpectedAlg)
+	})
+
+	t.Run("negative: weak rsa key", func(t *testing.T) {
+		weak, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+		_, err = NewKeyring(Key{ID: "weak", Signer: weak})
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+}
+
+func TestParseKeys_PEMFile(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "ed25519.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	keys, err := LoadKeyring("", oldKey.ID+"="+string(oldKey.Secret)+",ed-1=file:"+path)
+	require.NoError(t, err)
+	assert.Equal(t, "ed-1", keys.SigningKeyID())
+	assert.Len(t, keys.JWKS().Keys, 1)
+
+	_, err = LoadKeyring("", "ed-1=file:"+filepath.Join(t.TempDir(), "missing.pem"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func publicKeyFromJWK(t *testing.T, jwk JWK) interface{} {
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		require.NoError(t, err)
+		return b
+	}
+	switch jwk.KeyType {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	t.Fatalf("unexpected key type %q", jwk.KeyType)
+	return nil
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	minSecretLength = 32
+	minRSABits      = 2048
+	keyFilePrefix   = "file:"
+)
+
+// Key is either an HMAC secret or an asymmetric private key (*rsa.PrivateKey or ed25519.PrivateKey).
+type Key struct {
+	ID     string
+	Secret []byte
+	Signer crypto.Signer
+}
+
+func (k Key) method() (jwt.SigningMethod, error) {
+	switch signer := k.Signer.(type) {
+	case nil:
+		if len(k.Secret) < minSecretLength {
+			return nil, fmt.Errorf("%w: secret of %q is shorter than %d bytes", ErrInvalidKey, k.ID, minSecretLength)
+		}
+		return jwt.SigningMethodHS256, nil
+	case *rsa.PrivateKey:
+		if signer.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%w: rsa key %q is shorter than %d bits", ErrInvalidKey, k.ID, minRSABits)
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T for %q", ErrInvalidKey, signer, k.ID)
+	}
+}
+
+func (k Key) signingKey() interface{} {
+	if k.Signer != nil {
+		return k.Signer
+	}
+	return k.Secret
+}
+
+func (k Key) verificationKey() interface{} {
+	if k.Signer != nil {
+		return k.Signer.Public()
+	}
+	return k.Secret
+}
+
+type keyEntry struct {
+	key    Key
+	method jwt.SigningMethod
+}
+
+// Keyring signs tokens with its newest (last) key and verifies them with any key it holds,
+// so a rotated-out key keeps working until it is removed from the configuration.
+type Keyring struct {
+	byID   map[string]keyEntry
+	signer keyEntry
+	jwks   []JWK
+}
+
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	k := &Keyring{
+		byID: make(map[string]keyEntry, len(keys)),
+		jwks: make([]JWK, 0, len(keys)),
+	}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("%w: empty kid", ErrInvalidKey)
+		}
+		method, err := key.method()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.byID[key.ID]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateKey, key.ID)
+		}
+		entry := keyEntry{key: key, method: method}
+		k.byID[key.ID] = entry
+		k.signer = entry
+		if key.Signer != nil {
+			k.jwks = append(k.jwks, newJWK(key.ID, method.Alg(), key.Signer.Public()))
+		}
+	}
+	return k, nil
+}
+
+func NewEphemeralKeyring() (*Keyring, error) {
+	secret := make([]byte, minSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("error while generating signing key: %w", err)
+	}
+	return NewKeyring(Key{ID: "ephemeral-" + hex.EncodeToString(secret[:4]), Secret: secret})
+}
+
+// ParseKeys reads keys in the "<kid>=<secret>" or "<kid>=file:<path to PEM private key>" form,
+// one per line or separated by commas. Blank lines and lines starting with # are skipped;
+// the last key becomes the signing key.
+func ParseKeys(r io.Reader) ([]Key, error) {
+	var keys []Key
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		for _, entry := range strings.Split(scanner.Text(), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" || strings.HasPrefix(entry, "#") {
+				continue
+			}
+			id, value, ok := strings.Cut(entry, "=")
+			if !ok {
+				return nil, fmt.Errorf("%w: expected <kid>=<secret>", ErrInvalidKey)
+			}
+			key := Key{ID: strings.TrimSpace(id)}
+			value = strings.TrimSpace(value)
+			if path, isFile := strings.CutPrefix(value, keyFilePrefix); isFile {
+				signer, err := loadPrivateKey(path)
+				if err != nil {
+					return nil, fmt.Errorf("error while loading key %q: %w", key.ID, err)
+				}
+				key.Signer = signer
+			} else {
+				key.Secret = []byte(value)
+			}
+			keys = append(keys, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading signing keys: %w", err)
+	}
+	return keys, nil
+}
+
+func LoadKeyring(path string, inline string) (*Keyring, error) {
+	var keys []Key
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error while opening signing keys file: %w", err)
+		}
+		defer f.Close()
+		if keys, err = ParseKeys(f); err != nil {
+			return nil, err
+		}
+	}
+	if inline != "" {
+		inlineKeys, err := ParseKeys(strings.NewReader(inline))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, inlineKeys...)
+	}
+	return NewKeyring(keys...)
+}
+
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signer.method, claims)
+	token.Header["kid"] = k.signer.key.ID
+	return token.SignedString(k.signer.key.signingKey())
+}
+
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	validMethods := []string{
+		jwt.SigningMethodHS256.Alg(),
+		jwt.SigningMethodRS256.Alg(),
+		jwt.SigningMethodEdDSA.Alg(),
+	}
+	return jwt.ParseWithClaims(tokenString, claims, k.keyFunc, jwt.WithValidMethods(validMethods))
+}
+
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrMissingKeyID
+	}
+	entry, ok := k.byID[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if token.Method.Alg() != entry.method.Alg() {
+		return nil, fmt.Errorf("%w: key %q expects %s, got %s", ErrUnexpectedAlg, kid, entry.method.Alg(), token.Method.Alg())
+	}
+	return entry.key.verificationKey(), nil
+}
+
+func (k *Keyring) SigningKeyID() string {
+	return k.signer.key.ID
+}
+
+func (k *Keyring) JWKS() JWKSet {
+	return JWKSet{Keys: k.jwks}
+}
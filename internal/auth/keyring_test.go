@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	oldKey = Key{ID: "2023-08", Secret: []byte("old-secret-which-is-long-enough!")}
+	newKey = Key{ID: "2023-09", Secret: []byte("new-secret-which-is-long-enough!")}
+)
+
+func claims() *jwt.RegisteredClaims {
+	return &jwt.RegisteredClaims{
+		Subject:   "test-login",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	before, err := NewKeyring(oldKey)
+	require.NoError(t, err)
+	issuedBeforeRotation, err := before.Sign(claims())
+	require.NoError(t, err)
+
+	after, err := NewKeyring(oldKey, newKey)
+	require.NoError(t, err)
+	issuedAfterRotation, err := after.Sign(claims())
+	require.NoError(t, err)
+
+	t.Run("positive: newest key signs", func(t *testing.T) {
+		tkn, err := after.Parse(issuedAfterRotation, &jwt.RegisteredClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, newKey.ID, tkn.Header["kid"])
+	})
+	t.Run("positive: old tokens stay valid", func(t *testing.T) {
+		tkn, err := after.Parse(issuedBeforeRotation, &jwt.RegisteredClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, oldKey.ID, tkn.Header["kid"])
+	})
+	t.Run("negative: retired key is rejected", func(t *testing.T) {
+		retired, err := NewKeyring(newKey)
+		require.NoError(t, err)
+		_, err = retired.Parse(issuedBeforeRotation, &jwt.RegisteredClaims{})
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+	t.Run("negative: token without kid", func(t *testing.T) {
+		unsigned, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims()).SignedString(newKey.Secret)
+		require.NoError(t, err)
+		_, err = after.Parse(unsigned, &jwt.RegisteredClaims{})
+		assert.ErrorIs(t, err, ErrMissingKeyID)
+	})
+	t.Run("negative: forged signature", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+		token.Header["kid"] = newKey.ID
+		forged, err := token.SignedString([]byte("my_secret_key"))
+		require.NoError(t, err)
+		_, err = after.Parse(forged, &jwt.RegisteredClaims{})
+		assert.ErrorIs(t, err, jwt.ErrSignatureInvalid)
+	})
+}
+
+func TestNewKeyring(t *testing.T) {
+	testCases := []struct {
+		name        string
+		keys        []Key
+		expectedErr error
+	}{
+		{name: "negative: no keys", expectedErr: ErrNoKeys},
+		{name: "negative: short secret", keys: []Key{{ID: "short", Secret: []byte("my_secret_key")}}, expectedErr: ErrInvalidKey},
+		{name: "negative: empty kid", keys: []Key{{Secret: newKey.Secret}}, expectedErr: ErrInvalidKey},
+		{name: "negative: duplicate kid", keys: []Key{newKey, newKey}, expectedErr: ErrDuplicateKey},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.keys...)
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	content := "# rotated monthly\n" + oldKey.ID + "=" + string(oldKey.Secret) + "\n\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	keys, err := LoadKeyring(path, newKey.ID+"="+string(newKey.Secret))
+	require.NoError(t, err)
+	assert.Equal(t, newKey.ID, keys.SigningKeyID())
+
+	_, err = ParseKeys(strings.NewReader("no-separator"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const DefaultPasswordMinLength = 8
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+type PasswordPolicy struct {
+	MinLength int
+	denied    map[string]struct{}
+}
+
+// NewPasswordPolicy builds a policy with the given deny-list; a nil list falls back to the embedded one.
+func NewPasswordPolicy(minLength int, denyList io.Reader) (*PasswordPolicy, error) {
+	if denyList == nil {
+		denyList = strings.NewReader(commonPasswords)
+	}
+	p := &PasswordPolicy{
+		MinLength: minLength,
+		denied:    make(map[string]struct{}),
+	}
+	scanner := bufio.NewScanner(denyList)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.denied[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading password deny-list: %w", err)
+	}
+	return p, nil
+}
+
+func (p *PasswordPolicy) Validate(login string, password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: %w, need at least %d characters", ErrWeakPassword, ErrPasswordTooShort, p.MinLength)
+	}
+	if strings.EqualFold(password, login) {
+		return fmt.Errorf("%w: %w", ErrWeakPassword, ErrPasswordIsLogin)
+	}
+	if _, ok := p.denied[strings.ToLower(password)]; ok {
+		return fmt.Errorf("%w: %w", ErrWeakPassword, ErrPasswordTooCommon)
+	}
+	return nil
+}
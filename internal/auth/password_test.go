@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy, err := NewPasswordPolicy(DefaultPasswordMinLength, nil)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		login       string
+		password    string
+		expectedErr error
+	}{
+		{
+			name:     "positive: strong password",
+			login:    "test-login",
+			password: "s3cret-passw0rd",
+		},
+		{
+			name:        "negative: too short",
+			login:       "test-login",
+			password:    "s3cret",
+			expectedErr: ErrPasswordTooShort,
+		},
+		{
+			name:        "negative: same as login",
+			login:       "test-login",
+			password:    "TEST-LOGIN",
+			expectedErr: ErrPasswordIsLogin,
+		},
+		{
+			name:        "negative: common password",
+			login:       "test-login",
+			password:    "Password1",
+			expectedErr: ErrPasswordTooCommon,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.login, tt.password)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrWeakPassword)
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestNewPasswordPolicy_CustomDenyList(t *testing.T) {
+	policy, err := NewPasswordPolicy(4, strings.NewReader("# custom list\n\ngophermart\n"))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, policy.Validate("test-login", "GopherMart"), ErrPasswordTooCommon)
+	assert.NoError(t, policy.Validate("test-login", "password1"))
+}
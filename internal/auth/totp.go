@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters are the RFC 6238 defaults, which is all most authenticator apps support.
+const (
+	totpDigits      = 6
+	totpModulo      = 1_000_000
+	totpPeriod      = 30
+	totpSkew        = 1
+	totpSecretBytes = 20
+
+	recoveryCodeBytes = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func NewTOTPSecret() (string, error) {
+	b, err := randomBytes(totpSecretBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(b), nil
+}
+
+// TOTPURI builds the otpauth:// URI authenticator apps read from a QR code.
+func TOTPURI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpStep(t)), nil
+}
+
+// ValidateTOTP accepts codes from one step before or after t to tolerate clock drift and
+// returns the step the code belongs to, so the caller can refuse to accept it twice.
+func ValidateTOTP(secret string, code string, t time.Time) (int64, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+	current := totpStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, ErrInvalidTOTPCode
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTOTPSecret, err)
+	}
+	return key, nil
+}
+
+// hotp is the RFC 4226 HMAC-based one-time password with dynamic truncation.
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// NewRecoveryCodes returns single-use codes in the "xxxxxxxx-xxxxxxxx" form.
+func NewRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b, err := randomBytes(recoveryCodeBytes)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(b))
+		codes = append(codes, code[:len(code)/2]+"-"+code[len(code)/2:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode ignores case, spaces and dashes, so codes can be typed the way they were written down.
+func HashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return HashToken(normalized)
+}
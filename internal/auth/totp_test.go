@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed "12345678901234567890" from the RFC 6238 test vectors.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	testCases := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1111111111, expected: "050471"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+	}
+	for _, tt := range testCases {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, code)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step, err := ValidateTOTP(rfc6238Secret, "005924", now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1234567890/30), step)
+
+	previous, err := TOTPCode(rfc6238Secret, now.Add(-30*time.Second))
+	require.NoError(t, err)
+	step, err = ValidateTOTP(rfc6238Secret, previous, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1234567890/30-1), step)
+
+	stale, err := TOTPCode(rfc6238Secret, now.Add(-90*time.Second))
+	require.NoError(t, err)
+	_, err = ValidateTOTP(rfc6238Secret, stale, now)
+	assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+
+	_, err = ValidateTOTP("not base32!", "005924", now)
+	assert.ErrorIs(t, err, ErrInvalidTOTPSecret)
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	uri, err := url.Parse(TOTPURI("Gophermart", "test-login", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Gophermart:test-login", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Gophermart", uri.Query().Get("issuer"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+	seen := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{8}-[a-z2-7]{8}$`, code)
+		seen[code] = struct{}{}
+	}
+	assert.Len(t, seen, 10)
+	assert.Equal(t, HashRecoveryCode(codes[0]), HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))))
+}
@@ -0,0 +1,198 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultMinSize    = 1024
+	DefaultMaxBodyLen = 1 << 20
+)
+
+var (
+	DefaultContentTypes = []string{"application/json", "text/plain"}
+
+	ErrBodyTooLarge        = errors.New("decompressed request body is too large")
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+type Option func(c *Compressor)
+
+// WithMinSize sets the response size below which compression is not worth it.
+func WithMinSize(size int) Option {
+	return func(c *Compressor) {
+		c.minSize = size
+	}
+}
+
+// WithContentTypes sets the media types of compressed responses; "text/*" matches any text type.
+func WithContentTypes(contentTypes ...string) Option {
+	return func(c *Compressor) {
+		c.contentTypes = make(map[string]struct{}, len(contentTypes))
+		for _, contentType := range contentTypes {
+			c.contentTypes[strings.ToLower(strings.TrimSpace(contentType))] = struct{}{}
+		}
+	}
+}
+
+// WithMaxBodyLen limits decompressed request bodies, so a small compressed body cannot expand
+// into gigabytes in the handlers.
+func WithMaxBodyLen(size int64) Option {
+	return func(c *Compressor) {
+		c.maxBodyLen = size
+	}
+}
+
+type Compressor struct {
+	minSize      int
+	contentTypes map[string]struct{}
+	maxBodyLen   int64
+	gzipWriters  sync.Pool
+	zlibWriters  sync.Pool
+}
+
+func New(opts ...Option) *Compressor {
+	c := &Compressor{
+		minSize:    DefaultMinSize,
+		maxBodyLen: DefaultMaxBodyLen,
+	}
+	WithContentTypes(DefaultContentTypes...)(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.gzipWriters.New = func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}
+	c.zlibWriters.New = func() interface{} {
+		return zlib.NewWriter(io.Discard)
+	}
+	return c
+}
+
+// Handler decompresses gzip and deflate request bodies and compresses the responses
+// the client accepts compressed.
+func (c *Compressor) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.decodeRequest(r); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrUnsupportedEncoding) {
+				status = http.StatusUnsupportedMediaType
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if r.Method == http.MethodHead {
+			encoding = ""
+		}
+		cw := &compressWriter{ResponseWriter: w, compressor: c, encoding: encoding, status: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func (c *Compressor) decodeRequest(r *http.Request) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	var (
+		body io.ReadCloser
+		err  error
+	)
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(r.Body)
+	case "deflate":
+		body, err = zlib.NewReader(r.Body)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+	if err != nil {
+		return fmt.Errorf("error while decompressing request body: %w", err)
+	}
+	r.Body = &limitedBody{decoder: body, body: r.Body, remaining: c.maxBodyLen}
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return nil
+}
+
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if _, ok := c.contentTypes[mediaType]; ok {
+		return true
+	}
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	_, ok := c.contentTypes[mainType+"/*"]
+	return ok
+}
+
+// negotiateEncoding prefers gzip over deflate, honouring q=0 for explicitly refused encodings.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name != "" {
+			accepted[name] = q > 0
+		}
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[encoding]; listed {
+			if ok {
+				return encoding
+			}
+			continue
+		}
+		if accepted["*"] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+type limitedBody struct {
+	decoder   io.ReadCloser
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// One more byte tells a body of exactly the limit from a larger one.
+		var probe [1]byte
+		if n, _ := b.decoder.Read(probe[:]); n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.decoder.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	_ = b.decoder.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,216 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func deflated(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestCompressor_Request(t *testing.T) {
+	testCases := []struct {
+		name           string
+		encoding       string
+		body           []byte
+		maxBodyLen     int64
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "positive: gzip order upload",
+			encoding:       "gzip",
+			body:           gzipped(t, "12345678903"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "12345678903",
+		},
+		{
+			name:           "positive: deflate json",
+			encoding:       "deflate",
+			body:           deflated(t, `{"login": "test"}`),
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"login": "test"}`,
+		},
+		{
+			name:           "positive: plain body",
+			body:           []byte("12345678903"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "12345678903",
+		},
+		{
+			name:           "negative: corrupted body",
+			encoding:       "gzip",
+			body:           []byte("not gzip at all"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative: unsupported encoding",
+			encoding:       "br",
+			body:           []byte("12345678903"),
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "negative: body expands over the limit",
+			encoding:       "gzip",
+			body:           gzipped(t, strings.Repeat("0", 1024)),
+			maxBodyLen:     1023,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.maxBodyLen != 0 {
+				opts = append(opts, WithMaxBodyLen(tt.maxBodyLen))
+			}
+			handler := New(opts...).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Empty(t, r.Header.Get("Content-Encoding"))
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				w.Write(body)
+			}))
+			request := httptest.NewRequest(http.MethodPost, "/api/user/orders", bytes.NewReader(tt.body))
+			request.Header.Set("Content-Type", "text/plain")
+			if tt.encoding != "" {
+				request.Header.Set("Content-Encoding", tt.encoding)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompressor_Response(t *testing.T) {
+	largeJSON := `[` + strings.Repeat(`{"number": "12345678903", "status": "PROCESSED"},`, 50) + `{}]`
+	testCases := []struct {
+		name             string
+		acceptEncoding   string
+		contentType      string
+		status           int
+		body             string
+		expectedEncoding string
+	}{
+		{
+			name:             "positive: large json is gzipped",
+			acceptEncoding:   "gzip, deflate, br",
+			contentType:      "application/json",
+			body:             largeJSON,
+			expectedEncoding: "gzip",
+		},
+		{
+			name:             "positive: deflate when gzip is refused",
+			acceptEncoding:   "gzip;q=0, deflate",
+			contentType:      "application/json; charset=utf-8",
+			body:             largeJSON,
+			expectedEncoding: "deflate",
+		},
+		{
+			name:             "positive: any encoding",
+			acceptEncoding:   "*",
+			contentType:      "text/plain",
+			body:             largeJSON,
+			expectedEncoding: "gzip",
+		},
+		{
+			name:           "negative: below the threshold",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           `{"current": 500.5, "withdrawn": 42}`,
+		},
+		{
+			name:           "negative: content type is not allowed",
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			body:           largeJSON,
+		},
+		{
+			name:        "negative: client does not accept compression",
+			contentType: "application/json",
+			body:        largeJSON,
+		},
+		{
+			name:           "negative: no content",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			status:         http.StatusNoContent,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New().Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", tt.contentType)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				// Written in parts to cross the threshold in the middle of the response.
+				for i := 0; i < len(tt.body); i += 100 {
+					w.Write([]byte(tt.body[i:min(i+100, len(tt.body))]))
+				}
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			if tt.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			expectedStatus := http.StatusOK
+			if tt.status != 0 {
+				expectedStatus = tt.status
+			}
+			assert.Equal(t, expectedStatus, recorder.Code)
+			assert.Equal(t, tt.expectedEncoding, recorder.Header().Get("Content-Encoding"))
+			var body io.Reader = recorder.Body
+			switch tt.expectedEncoding {
+			case "gzip":
+				gz, err := gzip.NewReader(recorder.Body)
+				require.NoError(t, err)
+				body = gz
+			case "deflate":
+				zr, err := zlib.NewReader(recorder.Body)
+				require.NoError(t, err)
+				body = zr
+			}
+			decoded, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, string(decoded))
+		})
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
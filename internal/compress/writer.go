@@ -0,0 +1,142 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+)
+
+// compressWriter buffers the response until it reaches the minimal size, so small responses
+// go out as they are and the decision to compress is made once, before the headers are sent.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor  *Compressor
+	encoding    string
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	encoder     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	// Informational responses are not final, pass them through.
+	if status < http.StatusOK {
+		w.wroteHeader = false
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.compressor.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	compressible := header.Get("Content-Encoding") == "" && bodyAllowed(w.status) &&
+		w.compressor.compressible(header.Get("Content-Type"))
+	if compressible {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if compressible && large && w.encoding != "" {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.encoder = w.compressor.encoder(w.encoding, w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what is buffered: a streaming handler wants it delivered now, so it is
+// compressed regardless of the minimal size.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Close() {
+	if !w.decided {
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+		_ = w.decide(false)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		w.compressor.release(w.encoding, w.encoder)
+		w.encoder = nil
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (c *Compressor) encoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "gzip" {
+		gz := c.gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(w)
+		return gz
+	}
+	zw := c.zlibWriters.Get().(*zlib.Writer)
+	zw.Reset(w)
+	return zw
+}
+
+func (c *Compressor) release(encoding string, encoder io.WriteCloser) {
+	if encoding == "gzip" {
+		c.gzipWriters.Put(encoder)
+		return
+	}
+	c.zlibWriters.Put(encoder)
+}
+
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+)
+
+func (m *Manager) UserRoles(login string) ([]string, error) {
+	getRoles := `select role from user_roles where login = $1 order by role`
+	rows, err := m.db.Query(getRoles, login)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting roles of user %q: %w", login, err)
+	}
+	defer func() {
+		_ = rows.Close()
+		_ = rows.Err()
+	}()
+
+	roles := make([]string, 0)
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("error while scanning rows: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (m *Manager) GrantRole(login string, role string) error {
+	grantRole := `insert into user_roles (login, role) select login, $2 from registered_users where login = $1
+		on conflict (login, role) do update set role = excluded.role`
+	result, err := m.db.Exec(grantRole, login, role)
+	if err != nil {
+		return fmt.Errorf("error while granting role %q to user %q: %w", role, login, err)
+	}
+	granted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while granting role %q to user %q: %w", role, login, err)
+	}
+	if granted == 0 {
+		return ErrNoSuchUser
+	}
+	return nil
+}
+
+// RevokeRole also revokes the sessions of the user: access tokens carry the roles,
+// so without it the role would stay usable until the tokens expire.
+func (m *Manager) RevokeRole(login string, role string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	revokeRole := `delete from user_roles where login = $1 and role = $2`
+	if _, err = tx.Exec(revokeRole, login, role); err != nil {
+		return fmt.Errorf("error while revoking role %q from user %q: %w", role, login, err)
+	}
+	revokeSessions := `update sessions set revoked_at = now() where login = $1 and revoked_at is null`
+	if _, err = tx.Exec(revokeSessions, login); err != nil {
+		return fmt.Errorf("error while revoking sessions of user %q: %w", login, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing role revocation: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) GetUserInfo(login string) (models.UserInfo, error) {
+	getUser := `select u.login, u.blocked_at, coalesce(t.confirmed_at is not null, false), coalesce(a.balance, 0), coalesce(a.withdrawn, 0)
+		from registered_users u
+		left join user_totp t on t.login = u.login
+		left join accounts a on a.login = u.login
+		where u.login = $1`
+	var (
+		info      models.UserInfo
+		blockedAt sql.NullTime
+	)
+	err := m.db.QueryRow(getUser, login).Scan(&info.Login, &blockedAt, &info.TwoFactorEnabled, &info.Balance.Current, &info.Balance.Withdrawn)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UserInfo{}, ErrNoSuchUser
+		}
+		return models.UserInfo{}, fmt.Errorf("error while getting user %q: %w", login, err)
+	}
+	if blockedAt.Valid {
+		info.BlockedAt = &blockedAt.Time
+	}
+	if info.Roles, err = m.UserRoles(login); err != nil {
+		return models.UserInfo{}, err
+	}
+	return info, nil
+}
+
+// BlockUser keeps the user from logging in and ends every session and pending login right away.
+func (m *Manager) BlockUser(login string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	blockUser := `update registered_users set blocked_at = coalesce(blocked_at, now()) where login = $1`
+	if err = execOnUser(tx, blockUser, login); err != nil {
+		return err
+	}
+	revokeSessions := `update sessions set revoked_at = now() where login = $1 and revoked_at is null`
+	if _, err = tx.Exec(revokeSessions, login); err != nil {
+		return fmt.Errorf("error while revoking sessions of user %q: %w", login, err)
+	}
+	cancelChallenges := `update login_challenges set used_at = now() where login = $1 and used_at is null`
+	if _, err = tx.Exec(cancelChallenges, login); err != nil {
+		return fmt.Errorf("error while cancelling login challenges of user %q: %w", login, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing user block: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) UnblockUser(login string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	unblockUser := `update registered_users set blocked_at = null where login = $1`
+	if err = execOnUser(tx, unblockUser, login); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing user unblock: %w", err)
+	}
+	return nil
+}
+
+func execOnUser(tx *sql.Tx, query string, login string) error {
+	result, err := tx.Exec(query, login)
+	if err != nil {
+		return fmt.Errorf("error while updating user %q: %w", login, err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while updating user %q: %w", login, err)
+	}
+	if updated == 0 {
+		return ErrNoSuchUser
+	}
+	return nil
+}
+
+// RecheckOrder makes the accrual workers poll the order on their next pass.
+// Orders in a final status cannot change any more, so there is nothing to recheck.
+func (m *Manager) RecheckOrder(orderID string) error {
+	recheckOrder := `insert into accrual_queue (order_id)
+		select order_id from orders where order_id = $1 and status not in ($2, $3)
+		on conflict (order_id) do update set next_check_at = now(), attempts = 0, last_error = null`
+	result, err := m.db.Exec(recheckOrder, orderID, models.OrderStatusInvalid, models.OrderStatusProcessed)
+	if err != nil {
+		return fmt.Errorf("error while scheduling recheck of order %q: %w", orderID, err)
+	}
+	scheduled, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while scheduling recheck of order %q: %w", orderID, err)
+	}
+	if scheduled > 0 {
+		return nil
+	}
+	var exists bool
+	if err = m.db.QueryRow(`select exists(select 1 from orders where order_id = $1)`, orderID).Scan(&exists); err != nil {
+		return fmt.Errorf("error while searching for order %q: %w", orderID, err)
+	}
+	if !exists {
+		return ErrNoSuchOrder
+	}
+	return ErrOrderIsFinal
+}
+
+func (m *Manager) RecordAdminAction(entry models.AuditEntry) error {
+	recordAction := `insert into admin_audit_log (actor, action, target, status, ip, created_at) values ($1, $2, $3, $4, $5, now())`
+	if _, err := m.db.Exec(recordAction, entry.Actor, entry.Action, entry.Target, entry.Status, entry.IP); err != nil {
+		return fmt.Errorf("error while recording admin action %q of %q: %w", entry.Action, entry.Actor, err)
+	}
+	return nil
+}
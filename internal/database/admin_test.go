@@ -0,0 +1,124 @@
+package database
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestManager_GetUserInfo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	blockedAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`from registered_users u`).WithArgs("test-login").
+		WillReturnRows(sqlmock.NewRows([]string{"login", "blocked_at", "two_factor", "balance", "withdrawn"}).
+			AddRow("test-login", blockedAt, true, "100.50", "20"))
+	mock.ExpectQuery(regexp.QuoteMeta(`select role from user_roles where login = $1`)).WithArgs("test-login").
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin").AddRow("user"))
+	mock.ExpectQuery(`from registered_users u`).WithArgs("ghost").
+		WillReturnRows(sqlmock.NewRows([]string{"login", "blocked_at", "two_factor", "balance", "withdrawn"}))
+
+	manager := &Manager{db: db}
+	info, err := manager.GetUserInfo("test-login")
+	assert.NoError(t, err)
+	assert.Equal(t, models.UserInfo{
+		Login:            "test-login",
+		Roles:            []string{"admin", "user"},
+		BlockedAt:        &blockedAt,
+		TwoFactorEnabled: true,
+		Balance:          models.BalanceInfo{Current: 10050, Withdrawn: 2000},
+	}, info)
+	_, err = manager.GetUserInfo("ghost")
+	assert.ErrorIs(t, err, ErrNoSuchUser)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_BlockUser(t *testing.T) {
+	t.Run("positive: sessions and pending logins are ended", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`update registered_users set blocked_at = coalesce(blocked_at, now()) where login = $1`)).
+			WithArgs("test-login").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`update sessions set revoked_at = now() where login = $1`)).
+			WithArgs("test-login").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(regexp.QuoteMeta(`update login_challenges set used_at = now() where login = $1`)).
+			WithArgs("test-login").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		manager := &Manager{db: db}
+		assert.NoError(t, manager.BlockUser("test-login"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: no such user", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`update registered_users set blocked_at`).WithArgs("ghost").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		manager := &Manager{db: db}
+		assert.ErrorIs(t, manager.BlockUser("ghost"), ErrNoSuchUser)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestManager_RecheckOrder(t *testing.T) {
+	testCases := []struct {
+		name        string
+		scheduled   int64
+		exists      bool
+		expectedErr error
+	}{
+		{
+			name:      "positive: order is scheduled",
+			scheduled: 1,
+		},
+		{
+			name:        "negative: order is final",
+			exists:      true,
+			expectedErr: ErrOrderIsFinal,
+		},
+		{
+			name:        "negative: no such order",
+			expectedErr: ErrNoSuchOrder,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectExec(`insert into accrual_queue`).
+				WithArgs("2377225624", models.OrderStatusInvalid, models.OrderStatusProcessed).
+				WillReturnResult(sqlmock.NewResult(0, tt.scheduled))
+			if tt.scheduled == 0 {
+				mock.ExpectQuery(`select exists`).WithArgs("2377225624").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.exists))
+			}
+
+			manager := &Manager{db: db}
+			assert.ErrorIs(t, manager.RecheckOrder("2377225624"), tt.expectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"strings"
+	"time"
+)
+
+func (m *Manager) CreateAPIKey(key models.APIKey, keyHash string) error {
+	createKey := `insert into api_keys (id, login, name, key_hash, scopes, created_at, expires_at) values ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := m.db.Exec(createKey, key.ID, key.Login, key.Name, keyHash, strings.Join(key.Scopes, " "), key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error while creating api key for user %q: %w", key.Login, err)
+	}
+	return nil
+}
+
+func (m *Manager) ListAPIKeys(login string) ([]models.APIKey, error) {
+	getKeys := `select id, name, scopes, created_at, expires_at, last_used_at from api_keys
+		where login = $1 and revoked_at is null order by created_at`
+	rows, err := m.db.Query(getKeys, login)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting api keys of user %q: %w", login, err)
+	}
+	defer func() {
+		_ = rows.Close()
+		_ = rows.Err()
+	}()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		var (
+			key        = models.APIKey{Login: login}
+			scopes     string
+			lastUsedAt sql.NullTime
+		)
+		if err = rows.Scan(&key.ID, &key.Name, &scopes, &key.CreatedAt, &key.ExpiresAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning rows: %w", err)
+		}
+		key.Scopes = strings.Fields(scopes)
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoData
+	}
+	return keys, nil
+}
+
+func (m *Manager) RevokeAPIKey(login string, id string) error {
+	revokeKey := `update api_keys set revoked_at = now() where id = $1 and login = $2 and revoked_at is null`
+	result, err := m.db.Exec(revokeKey, id, login)
+	if err != nil {
+		return fmt.Errorf("error while revoking api key %q: %w", id, err)
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while revoking api key %q: %w", id, err)
+	}
+	if revoked == 0 {
+		return ErrNoSuchAPIKey
+	}
+	return nil
+}
+
+// AuthenticateAPIKey finds an active key of a user that is not blocked and marks it as used.
+func (m *Manager) AuthenticateAPIKey(keyHash string) (models.APIKey, error) {
+	useKey := `update api_keys k set last_used_at = now()
+		from registered_users u
+		where k.key_hash = $1 and u.login = k.login and u.blocked_at is null
+			and k.revoked_at is null and k.expires_at > now()
+		returning k.id, k.login, k.name, k.scopes, k.created_at, k.expires_at, k.last_used_at`
+	var (
+		key        models.APIKey
+		scopes     string
+		lastUsedAt time.Time
+	)
+	err := m.db.QueryRow(useKey, keyHash).Scan(&key.ID, &key.Login, &key.Name, &scopes, &key.CreatedAt, &key.ExpiresAt, &lastUsedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIKey{}, ErrAPIKeyInvalid
+		}
+		return models.APIKey{}, fmt.Errorf("error while authenticating api key: %w", err)
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.LastUsedAt = &lastUsedAt
+	return key, nil
+}
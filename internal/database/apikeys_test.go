@@ -0,0 +1,61 @@
+package database
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestManager_AuthenticateAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	createdAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := createdAt.Add(90 * 24 * time.Hour)
+	usedAt := createdAt.Add(time.Hour)
+	columns := []string{"id", "login", "name", "scopes", "created_at", "expires_at", "last_used_at"}
+	mock.ExpectQuery(`update api_keys k set last_used_at = now\(\)`).WithArgs("valid-hash").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("0123456789abcdef", "test-login", "partner", "orders:read balance:read", createdAt, expiresAt, usedAt))
+	mock.ExpectQuery(`update api_keys k set last_used_at = now\(\)`).WithArgs("revoked-hash").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	manager := &Manager{db: db}
+	key, err := manager.AuthenticateAPIKey("valid-hash")
+	assert.NoError(t, err)
+	assert.Equal(t, models.APIKey{
+		ID:         "0123456789abcdef",
+		Login:      "test-login",
+		Name:       "partner",
+		Scopes:     []string{models.ScopeOrdersRead, models.ScopeBalanceRead},
+		CreatedAt:  createdAt,
+		ExpiresAt:  expiresAt,
+		LastUsedAt: &usedAt,
+	}, key)
+	_, err = manager.AuthenticateAPIKey("revoked-hash")
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_RevokeAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	revokeKey := regexp.QuoteMeta(`update api_keys set revoked_at = now() where id = $1 and login = $2 and revoked_at is null`)
+	mock.ExpectExec(revokeKey).WithArgs("0123456789abcdef", "test-login").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(revokeKey).WithArgs("0123456789abcdef", "other-login").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	manager := &Manager{db: db}
+	assert.NoError(t, manager.RevokeAPIKey("test-login", "0123456789abcdef"))
+	assert.ErrorIs(t, manager.RevokeAPIKey("other-login", "0123456789abcdef"), ErrNoSuchAPIKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -6,32 +6,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
-	"golang.org/x/crypto/bcrypt"
+	"go.uber.org/zap"
 	"time"
 )
 
+const dummyPassword = "gophermart-dummy-password"
+
 func (m *Manager) GetBalanceInfo(login string) ([]byte, error) {
-	userBalance, err := m.getUserBalance(login)
-	if err != nil {
-		return nil, fmt.Errorf("error while getting current user userBalance: %w", err)
-	}
-	getUserWithdrawn := "select sum(amount) as withdrawn from withdraw where login = $1"
-	row := m.db.QueryRow(getUserWithdrawn, login)
-	var userWithdrawn sql.NullFloat64
-	if err = row.Scan(&userWithdrawn); err != nil {
+	getUserBalance := `select balance, withdrawn from accounts where login = $1`
+	var info models.BalanceInfo
+	if err := m.db.QueryRow(getUserBalance, login).Scan(&info.Current, &info.Withdrawn); err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("error while getting user withdrawn info: %w", err)
-		}
-		userWithdrawn = sql.NullFloat64{
-			Float64: 0,
-			Valid:   true,
+			return nil, fmt.Errorf("error while getting user balance info: %w", err)
 		}
 	}
-	info := models.BalanceInfo{
-		Withdrawn: userWithdrawn.Float64,
-		Current:   userBalance,
-	}
 	result, err := json.Marshal(info)
 	if err != nil {
 		return nil, fmt.Errorf("error while marshalling user balance info: %w", err)
@@ -54,7 +44,7 @@ func (m *Manager) GetWithdrawals(login string) ([]byte, error) {
 	for rows.Next() {
 		var (
 			orderID     string
-			amount      float64
+			amount      models.Money
 			processedAt time.Time
 		)
 		if err = rows.Scan(&orderID, &amount, &processedAt); err != nil {
@@ -76,18 +66,47 @@ func (m *Manager) GetWithdrawals(login string) ([]byte, error) {
 	return result, nil
 }
 
-func (m *Manager) Withdraw(login string, orderID string, sum float64) error {
-	userBalance, err := m.getUserBalance(login)
+func (m *Manager) Withdraw(login string, orderID string, sum models.Money) error {
+	// A negative withdrawal would credit the user: the ledger keeps it balanced, but it mints points.
+	if sum <= 0 {
+		return ErrInvalidAmount
+	}
+	tx, err := m.db.Begin()
 	if err != nil {
-		return fmt.Errorf("error while checking user userBalance: %w", err)
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var userBalance models.Money
+	getUserBalance := `select balance from accounts where login = $1 for update`
+	if err = tx.QueryRow(getUserBalance, login).Scan(&userBalance); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error while checking user balance: %w", err)
 	}
 	if userBalance < sum {
 		return ErrInsufficientBalance
 	}
 	withdraw := "insert into withdraw values ($1, $2, now(), $3)"
-	if _, err = m.db.Exec(withdraw, login, orderID, sum); err != nil {
+	if _, err = tx.Exec(withdraw, login, orderID, sum); err != nil {
 		return fmt.Errorf("error while trying to withdraw: %w", err)
 	}
+	if err = m.ensureUserAccount(tx, login); err != nil {
+		return err
+	}
+	if _, err = m.postTransaction(tx, withdrawalTransaction(orderID),
+		ledgerEntry{account: userAccount(login), amount: -sum},
+		ledgerEntry{account: withdrawalsAccount, amount: sum},
+	); err != nil {
+		return err
+	}
+	updateWithdrawn := `update accounts set withdrawn = withdrawn + $1 where id = $2`
+	if _, err = tx.Exec(updateWithdrawn, sum, userAccount(login)); err != nil {
+		return fmt.Errorf("error while updating withdrawn sum: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing withdrawal: %w", err)
+	}
 	return nil
 }
 
@@ -107,7 +126,7 @@ func (m *Manager) GetUserOrders(login string) ([]byte, error) {
 		var (
 			orderID    string
 			status     models.OrderStatus
-			accrual    sql.NullFloat64
+			accrual    models.Money
 			uploadedAt time.Time
 		)
 		if err = rows.Scan(&orderID, &status, &accrual, &uploadedAt); err != nil {
@@ -115,7 +134,7 @@ func (m *Manager) GetUserOrders(login string) ([]byte, error) {
 		}
 		userOrders = append(userOrders, models.OrderInfo{
 			OrderID:   orderID,
-			Accrual:   accrual.Float64,
+			Accrual:   accrual,
 			CreatedAt: &uploadedAt,
 			Status:    status,
 		})
@@ -129,33 +148,92 @@ func (m *Manager) GetUserOrders(login string) ([]byte, error) {
 	}
 	return result, nil
 }
-func (m *Manager) GetAllOrders() ([]string, error) {
-	getAllOrders := `select order_id from orders`
-	rows, err := m.db.Query(getAllOrders)
+func (m *Manager) ClaimOrders(limit int, lease time.Duration) ([]models.AccrualJob, error) {
+	claimOrders := `update accrual_queue set next_check_at = now() + $2 * interval '1 millisecond', attempts = attempts + 1
+		where order_id in (
+			select order_id from accrual_queue where next_check_at <= now() order by next_check_at limit $1 for update skip locked
+		) returning order_id, attempts`
+	rows, err := m.db.Query(claimOrders, limit, lease.Milliseconds())
 	if err != nil {
-		return nil, fmt.Errorf("error while getting all orders from db: %w", err)
+		return nil, fmt.Errorf("error while claiming orders from accrual queue: %w", err)
 	}
 	defer func() {
 		_ = rows.Close()
 		_ = rows.Err()
 	}()
 
-	orders := make([]string, 0)
+	jobs := make([]models.AccrualJob, 0)
 	for rows.Next() {
-		var orderID string
-		if err = rows.Scan(&orderID); err != nil {
+		var job models.AccrualJob
+		if err = rows.Scan(&job.OrderID, &job.Attempts); err != nil {
 			return nil, fmt.Errorf("error while scanning rows: %w", err)
 		}
-		orders = append(orders, orderID)
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (m *Manager) RescheduleOrder(orderID string, delay time.Duration, reason error) error {
+	var lastError sql.NullString
+	if reason != nil {
+		lastError = sql.NullString{String: reason.Error(), Valid: true}
 	}
-	return orders, nil
+	rescheduleOrder := `update accrual_queue set next_check_at = now() + $1 * interval '1 millisecond', last_error = $2 where order_id = $3`
+	if _, err := m.db.Exec(rescheduleOrder, delay.Milliseconds(), lastError, orderID); err != nil {
+		return fmt.Errorf("error while rescheduling order %q: %w", orderID, err)
+	}
+	return nil
 }
 
-func (m *Manager) UpdateOrderInfo(orderInfo *models.OrderInfo) error {
+func (m *Manager) UpdateOrderInfo(orderInfo *models.OrderInfo, recheckAfter time.Duration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	getOrderStatus := `select status, login from orders where order_id = $1 for update`
+	var (
+		currentStatus models.OrderStatus
+		login         string
+	)
+	if err = tx.QueryRow(getOrderStatus, orderInfo.Order).Scan(&currentStatus, &login); err != nil {
+		return fmt.Errorf("error while getting current order status: %w", err)
+	}
+	if err = currentStatus.TransitionTo(orderInfo.Status); err != nil {
+		return err
+	}
 	updateOrderInfo := `update orders set status=$1, accrual=$2 where order_id=$3`
-	if _, err := m.db.Exec(updateOrderInfo, string(orderInfo.Status), orderInfo.Accrual, orderInfo.Order); err != nil {
+	if _, err = tx.Exec(updateOrderInfo, string(orderInfo.Status), orderInfo.Accrual, orderInfo.Order); err != nil {
 		return fmt.Errorf("error while updating order info: %w", err)
 	}
+	if orderInfo.Status == models.OrderStatusProcessed && orderInfo.Accrual > 0 {
+		if err = m.ensureUserAccount(tx, login); err != nil {
+			return err
+		}
+		if _, err = m.postTransaction(tx, accrualTransaction(*orderInfo.Order),
+			ledgerEntry{account: accrualAccount, amount: -orderInfo.Accrual},
+			ledgerEntry{account: userAccount(login), amount: orderInfo.Accrual},
+		); err != nil {
+			return err
+		}
+	}
+	if orderInfo.Status.IsFinal() {
+		dequeueOrder := `delete from accrual_queue where order_id = $1`
+		if _, err = tx.Exec(dequeueOrder, orderInfo.Order); err != nil {
+			return fmt.Errorf("error while removing order from accrual queue: %w", err)
+		}
+	} else {
+		rescheduleOrder := `update accrual_queue set next_check_at = now() + $1 * interval '1 millisecond', attempts = 0, last_error = null where order_id = $2`
+		if _, err = tx.Exec(rescheduleOrder, recheckAfter.Milliseconds(), orderInfo.Order); err != nil {
+			return fmt.Errorf("error while rescheduling order: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing order info: %w", err)
+	}
 	return nil
 }
 
@@ -167,8 +245,9 @@ func (m *Manager) LoadOrder(login string, orderID string) error {
 	err := row.Scan(&userName)
 	switch err {
 	case sql.ErrNoRows:
-		loadOrderQuery := `insert into orders values ($1, $2, now(), $3, $4)`
-		if _, err = m.db.Exec(loadOrderQuery, orderID, login, models.OrderStatus("NEW"), 0); err != nil {
+		loadOrderQuery := `with o as (insert into orders values ($1, $2, now(), $3, $4) returning order_id)
+			insert into accrual_queue (order_id) select order_id from o`
+		if _, err = m.db.Exec(loadOrderQuery, orderID, login, models.OrderStatusNew, 0); err != nil {
 			return fmt.Errorf("error while loading order %s: %w", orderID, err)
 		}
 		return nil
@@ -183,12 +262,13 @@ func (m *Manager) LoadOrder(login string, orderID string) error {
 }
 
 func (m *Manager) Register(login string, password string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := m.passwords.Hash(password)
 	if err != nil {
-		return fmt.Errorf("this password is not allowed: %w", err)
+		return err
 	}
-	registerUser := `insert into registered_users values ($1, $2)`
-	if _, err = m.db.Exec(registerUser, login, hash); err != nil {
+	registerUser := `with u as (insert into registered_users values ($1, $2) returning login)
+		insert into user_roles (login, role) select login, $3 from u`
+	if _, err = m.db.Exec(registerUser, login, hash, models.RoleUser); err != nil {
 		dublicateKeyErr := ErrDublicateKey{Key: "registered_users_pkey"}
 		if err.Error() == dublicateKeyErr.Error() {
 			return ErrUserAlreadyExists
@@ -199,69 +279,87 @@ func (m *Manager) Register(login string, password string) error {
 }
 
 func (m *Manager) Login(login string, password string) error {
-	getRegisteredUser := `select login, password from registered_users`
-	rows, err := m.db.Query(getRegisteredUser)
-	if err != nil {
+	getRegisteredUser := `select password, blocked_at is not null from registered_users where login = $1`
+	var (
+		passwordFromDB sql.NullString
+		blocked        bool
+	)
+	if err := m.db.QueryRow(getRegisteredUser, login).Scan(&passwordFromDB, &blocked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_, _ = m.passwords.Verify(password, m.dummyHash)
+			return ErrNoSuchUser
+		}
 		return fmt.Errorf("error while executing search query: %w", err)
 	}
-	defer func() {
-		_ = rows.Close()
-		_ = rows.Err()
-	}()
-	for rows.Next() {
-		var loginFromDB, passwordFromDB string
-		if err = rows.Scan(&loginFromDB, &passwordFromDB); err != nil {
-			return fmt.Errorf("error while scanning rows: %w", err)
-		}
-		if loginFromDB == login {
-			if err = bcrypt.CompareHashAndPassword([]byte(passwordFromDB), []byte(password)); err != nil {
-				return ErrInvalidCredentials
-			}
-			return nil
-		}
+	// Users provisioned by single sign-on have no password until they reset it.
+	if !passwordFromDB.Valid {
+		_, _ = m.passwords.Verify(password, m.dummyHash)
+		return ErrInvalidCredentials
+	}
+	rehash, err := m.passwords.Verify(password, passwordFromDB.String)
+	if err != nil {
+		return ErrInvalidCredentials
 	}
-	return ErrNoSuchUser
+	// Checked only after the password, so the block does not reveal itself to someone guessing it.
+	if blocked {
+		return ErrUserBlocked
+	}
+	if rehash {
+		m.upgradePasswordHash(login, password, passwordFromDB.String)
+	}
+	return nil
 }
 
-func (m *Manager) getUserBalance(login string) (float64, error) {
-	getUserBalance := "select coalesce(sum(accrual), 0) - coalesce(sum(amount), 0) as balance from orders o left join withdraw w on o.login = w.login where o.login = $1 group by o.login;"
-	row := m.db.QueryRow(getUserBalance, login)
-	var balance sql.NullFloat64
-	if err := row.Scan(&balance); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, nil
-		}
-		return 0, fmt.Errorf("error while getting user balance: %w", err)
+// upgradePasswordHash is best effort: the user is already authenticated, and a failed
+// upgrade is simply retried on the next login. The old hash in the condition keeps it
+// from overwriting a password that was changed concurrently.
+func (m *Manager) upgradePasswordHash(login string, password string, oldHash string) {
+	hash, err := m.passwords.Hash(password)
+	if err != nil {
+		m.log.Warnf("error while upgrading password hash of user %q: %s", login, err.Error())
+		return
+	}
+	upgradeHash := `update registered_users set password = $2 where login = $1 and password = $3`
+	if _, err = m.db.Exec(upgradeHash, login, hash, oldHash); err != nil {
+		m.log.Warnf("error while upgrading password hash of user %q: %s", login, err.Error())
 	}
-	return balance.Float64, nil
 }
 
-func (m *Manager) init(ctx context.Context) error {
-	createRegisteredQuery := `create table if not exists registered_users (login text primary key, password text)`
-	if _, err := m.db.ExecContext(ctx, createRegisteredQuery); err != nil {
-		return fmt.Errorf("error while trying to create table with registered users: %w", err)
-	}
-	createOrdersQuery := `create table if not exists orders (order_id text unique, login text, uploaded_at timestamp with time zone, status text, accrual double precision, primary key(order_id))`
-	if _, err := m.db.ExecContext(ctx, createOrdersQuery); err != nil {
-		return fmt.Errorf("error while trying to create table with orders: %w", err)
+type Option func(*Manager)
+
+func WithPasswordHasher(passwords *auth.PasswordHasher) Option {
+	return func(m *Manager) {
+		m.passwords = passwords
 	}
-	createWithdrawQuery := `create table if not exists withdraw (login text, order_id text unique, processed_at timestamp with time zone, amount double precision, primary key(login, order_id))`
-	if _, err := m.db.ExecContext(ctx, createWithdrawQuery); err != nil {
-		return fmt.Errorf("error while trying to create table with orders: %w", err)
+}
+
+func WithLogger(log *zap.SugaredLogger) Option {
+	return func(m *Manager) {
+		m.log = log
 	}
-	return nil
 }
 
-func New(ctx context.Context, db *sql.DB) (*Manager, error) {
+func New(ctx context.Context, db *sql.DB, opts ...Option) (*Manager, error) {
 	m := Manager{
-		db: db,
+		db:        db,
+		passwords: defaultPasswordHasher,
+		log:       zap.NewNop().Sugar(),
+	}
+	for _, opt := range opts {
+		opt(&m)
 	}
-	if err := m.init(ctx); err != nil {
-		return nil, err
+	dummyHash, err := m.passwords.Hash(dummyPassword)
+	if err != nil {
+		return nil, fmt.Errorf("error while hashing dummy password: %w", err)
 	}
+	m.dummyHash = dummyHash
 	return &m, nil
 }
 
 type Manager struct {
-	db *sql.DB
+	db        *sql.DB
+	passwords *auth.PasswordHasher
+	log       *zap.SugaredLogger
+	// dummyHash is verified against when the login is unknown, so both cases take equally long.
+	dummyHash string
 }
@@ -7,14 +7,16 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	"golang.org/x/crypto/bcrypt"
 	"regexp"
 	"testing"
 	"time"
 )
 
-func TestManager_GetAllOrders(t *testing.T) {
-	t.Run("positive: orders exist", func(t *testing.T) {
+func TestManager_ClaimOrders(t *testing.T) {
+	t.Run("positive: orders claimed", func(t *testing.T) {
 		ctx := context.Background()
 		db, mock, err := sqlmock.New()
 		if err != nil {
@@ -22,20 +24,16 @@ func TestManager_GetAllOrders(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
-		mock.ExpectQuery(`select order_id from orders`).WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow("100500"))
+		mock.ExpectQuery(regexp.QuoteMeta(`update accrual_queue set next_check_at`)).WithArgs(10, int64(60000)).WillReturnRows(sqlmock.NewRows([]string{"order_id", "attempts"}).AddRow("100500", 1))
 
 		manager, err := New(ctx, db)
 		assert.NoError(t, err)
-		orders, err := manager.GetAllOrders()
+		orders, err := manager.ClaimOrders(10, time.Minute)
 		assert.NoError(t, err)
-		assert.Equal(t, orders, []string{"100500"})
+		assert.Equal(t, orders, []models.AccrualJob{{OrderID: "100500", Attempts: 1}})
 	})
 
-	t.Run("positive: no orders", func(t *testing.T) {
+	t.Run("positive: no pending orders", func(t *testing.T) {
 		ctx := context.Background()
 		db, mock, err := sqlmock.New()
 		if err != nil {
@@ -43,44 +41,54 @@ func TestManager_GetAllOrders(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
-		mock.ExpectQuery(`select order_id from orders`).WillReturnRows(sqlmock.NewRows([]string{"order_id"}))
+		mock.ExpectQuery(regexp.QuoteMeta(`update accrual_queue set next_check_at`)).WithArgs(10, int64(60000)).WillReturnRows(sqlmock.NewRows([]string{"order_id", "attempts"}))
 
 		manager, err := New(ctx, db)
 		assert.NoError(t, err)
-		orders, err := manager.GetAllOrders()
+		orders, err := manager.ClaimOrders(10, time.Minute)
 		assert.NoError(t, err)
-		assert.Equal(t, orders, []string{})
+		assert.Equal(t, orders, []models.AccrualJob{})
 	})
 }
 
+func TestManager_RescheduleOrder(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(`update accrual_queue set next_check_at`)).
+		WithArgs(int64(10000), "accrual is unavailable", "100500").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+	err = manager.RescheduleOrder("100500", 10*time.Second, errors.New("accrual is unavailable"))
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestManager_GetBalanceInfo(t *testing.T) {
 	testCases := []struct {
-		name        string
-		balance     *sqlmock.Rows
-		withdrawals *sqlmock.Rows
-		result      string
+		name    string
+		balance *sqlmock.Rows
+		result  string
 	}{
 		{
-			name:        "positive",
-			balance:     sqlmock.NewRows([]string{"balance"}).AddRow(100.5),
-			withdrawals: sqlmock.NewRows([]string{"withdrawn"}).AddRow(30.4),
-			result:      `{"current":100.5,"withdrawn":30.4}`,
+			name:    "positive",
+			balance: sqlmock.NewRows([]string{"balance", "withdrawn"}).AddRow(100.5, 30.4),
+			result:  `{"current":100.5,"withdrawn":30.4}`,
 		},
 		{
-			name:        "positive: no withdrawals",
-			balance:     sqlmock.NewRows([]string{"balance"}).AddRow(100.5),
-			withdrawals: sqlmock.NewRows([]string{"withdrawn"}),
-			result:      `{"current":100.5,"withdrawn":0}`,
+			name:    "positive: no withdrawals",
+			balance: sqlmock.NewRows([]string{"balance", "withdrawn"}).AddRow(100.5, 0),
+			result:  `{"current":100.5,"withdrawn":0}`,
 		},
 		{
-			name:        "positive: no withdrawals and no accruals",
-			balance:     sqlmock.NewRows([]string{"balance"}),
-			withdrawals: sqlmock.NewRows([]string{"withdrawn"}),
-			result:      `{"current":0,"withdrawn":0}`,
+			name:    "positive: no withdrawals and no accruals",
+			balance: sqlmock.NewRows([]string{"balance", "withdrawn"}),
+			result:  `{"current":0,"withdrawn":0}`,
 		},
 	}
 	for _, tt := range testCases {
@@ -91,13 +99,8 @@ func TestManager_GetBalanceInfo(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
 		t.Run(tt.name, func(t *testing.T) {
-			mock.ExpectQuery(regexp.QuoteMeta(`select coalesce(sum(accrual), 0) - coalesce(sum(amount), 0) as balance from orders o left join withdraw`)).WillReturnRows(tt.balance)
-			mock.ExpectQuery(regexp.QuoteMeta(`select sum(amount) as withdrawn from withdraw where login`)).WillReturnRows(tt.withdrawals)
+			mock.ExpectQuery(regexp.QuoteMeta(`select balance, withdrawn from accounts where login = $1`)).WithArgs("test-login").WillReturnRows(tt.balance)
 			manager, err := New(ctx, db)
 			assert.NoError(t, err)
 
@@ -137,10 +140,6 @@ func TestManager_GetWithdrawals(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
 		t.Run(tt.name, func(t *testing.T) {
 			mock.ExpectQuery(regexp.QuoteMeta(`select order_id, amount, processed_at from withdraw`)).WillReturnRows(tt.withdrawals)
 			manager, err := New(ctx, db)
@@ -160,20 +159,36 @@ func TestManager_Withdraw(t *testing.T) {
 	testCases := []struct {
 		name          string
 		balance       *sqlmock.Rows
-		sum           float64
+		sum           models.Money
 		expectedError error
 	}{
 		{
 			name:    "positive",
-			sum:     50.5,
+			sum:     5050,
 			balance: sqlmock.NewRows([]string{"balance"}).AddRow(100.5),
 		},
 		{
 			name:          "negative: insufficient balance",
-			sum:           150.5,
+			sum:           15050,
 			balance:       sqlmock.NewRows([]string{"balance"}).AddRow(100.5),
 			expectedError: ErrInsufficientBalance,
 		},
+		{
+			name:          "negative: no account",
+			sum:           1000,
+			balance:       sqlmock.NewRows([]string{"balance"}),
+			expectedError: ErrInsufficientBalance,
+		},
+		{
+			name:          "negative: zero sum",
+			sum:           0,
+			expectedError: ErrInvalidAmount,
+		},
+		{
+			name:          "negative: negative sum",
+			sum:           -50000,
+			expectedError: ErrInvalidAmount,
+		},
 	}
 	for _, tt := range testCases {
 		ctx := context.Background()
@@ -183,18 +198,29 @@ func TestManager_Withdraw(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
 		t.Run(tt.name, func(t *testing.T) {
-			mock.ExpectQuery(regexp.QuoteMeta(`select coalesce(sum(accrual), 0) - coalesce(sum(amount), 0) as balance from orders o left join withdraw`)).WillReturnRows(tt.balance)
-			mock.ExpectExec(`insert into withdraw values`).WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.balance != nil {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`select balance from accounts where login = $1 for update`)).WithArgs("test-login").WillReturnRows(tt.balance)
+			}
+			if tt.expectedError == nil {
+				mock.ExpectExec(`insert into withdraw values`).WithArgs("test-login", "100500", tt.sum).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`insert into accounts`).WithArgs("user:test-login", "test-login").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`insert into ledger_entries`).WithArgs("withdrawal:100500", "user:test-login", -tt.sum).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`update accounts set balance`).WithArgs(-tt.sum, "user:test-login").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`insert into ledger_entries`).WithArgs("withdrawal:100500", withdrawalsAccount, tt.sum).WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec(`update accounts set balance`).WithArgs(tt.sum, withdrawalsAccount).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`update accounts set withdrawn`).WithArgs(tt.sum, "user:test-login").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else if tt.balance != nil {
+				mock.ExpectRollback()
+			}
 			manager, err := New(ctx, db)
 			assert.NoError(t, err)
 
 			err = manager.Withdraw("test-login", "100500", tt.sum)
 			assert.Equal(t, err, tt.expectedError)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
@@ -229,10 +255,6 @@ func TestManager_GetUserOrders(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
 		t.Run(tt.name, func(t *testing.T) {
 			mock.ExpectQuery(regexp.QuoteMeta(`select order_id, status, accrual, uploaded_at from orders`)).WithArgs("test-login").WillReturnRows(tt.orders)
 			manager, err := New(ctx, db)
@@ -249,38 +271,49 @@ func TestManager_GetUserOrders(t *testing.T) {
 }
 
 func TestManager_UpdateOrderInfo(t *testing.T) {
-	t.Run("positive", func(t *testing.T) {
-		ctx := context.Background()
-		db, mock, err := sqlmock.New()
-		if err != nil {
-			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-		}
-		defer db.Close()
-
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
-		login := "test-login"
-		order := "100500"
-		orderTime := time.Now()
-		info := models.OrderInfo{
-			UserName:  &login,
-			OrderID:   order,
-			Order:     &order,
-			CreatedAt: &orderTime,
-			Status:    "NOW",
-			Accrual:   100.5,
-		}
-
-		mock.ExpectExec(regexp.QuoteMeta(`update orders set`)).WithArgs(info.Status, info.Accrual, info.OrderID).WillReturnResult(sqlmock.NewResult(0, 0))
-		manager, err := New(ctx, db)
-		assert.NoError(t, err)
-
-		err = manager.UpdateOrderInfo(&info)
-		assert.NoError(t, err)
-	})
-	t.Run("negative", func(t *testing.T) {
+	testCases := []struct {
+		name          string
+		currentStatus models.OrderStatus
+		status        models.OrderStatus
+		queueQuery    string
+		postedEntries int64
+		updateErr     error
+		expectedErr   string
+	}{
+		{
+			name:          "positive: order is rescheduled",
+			currentStatus: models.OrderStatusNew,
+			status:        models.OrderStatusProcessing,
+			queueQuery:    `update accrual_queue set next_check_at`,
+		},
+		{
+			name:          "positive: accrual is posted and order leaves the queue",
+			currentStatus: models.OrderStatusProcessing,
+			status:        models.OrderStatusProcessed,
+			queueQuery:    `delete from accrual_queue`,
+			postedEntries: 1,
+		},
+		{
+			name:          "positive: accrual was already posted",
+			currentStatus: models.OrderStatusProcessing,
+			status:        models.OrderStatusProcessed,
+			queueQuery:    `delete from accrual_queue`,
+		},
+		{
+			name:          "negative: illegal transition",
+			currentStatus: models.OrderStatusProcessed,
+			status:        models.OrderStatusProcessing,
+			expectedErr:   "illegal order status transition: PROCESSED -> PROCESSING",
+		},
+		{
+			name:          "negative",
+			currentStatus: models.OrderStatusNew,
+			status:        models.OrderStatusProcessing,
+			updateErr:     errors.New("some error"),
+			expectedErr:   "error while updating order info: some error",
+		},
+	}
+	for _, tt := range testCases {
 		ctx := context.Background()
 		db, mock, err := sqlmock.New()
 		if err != nil {
@@ -288,29 +321,53 @@ func TestManager_UpdateOrderInfo(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
-		login := "test-login"
-		order := "100500"
-		orderTime := time.Now()
-		info := models.OrderInfo{
-			UserName:  &login,
-			OrderID:   order,
-			Order:     &order,
-			CreatedAt: &orderTime,
-			Status:    "NOW",
-			Accrual:   100.5,
-		}
+		t.Run(tt.name, func(t *testing.T) {
+			login := "test-login"
+			order := "100500"
+			orderTime := time.Now()
+			info := models.OrderInfo{
+				UserName:  &login,
+				OrderID:   order,
+				Order:     &order,
+				CreatedAt: &orderTime,
+				Status:    tt.status,
+				Accrual:   10050,
+			}
 
-		mock.ExpectExec(regexp.QuoteMeta(`update orders set`)).WithArgs(info.Status, info.Accrual, info.OrderID).WillReturnError(errors.New("some error"))
-		manager, err := New(ctx, db)
-		assert.NoError(t, err)
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(`select status, login from orders where order_id = $1 for update`)).WithArgs(info.OrderID).
+				WillReturnRows(sqlmock.NewRows([]string{"status", "login"}).AddRow(tt.currentStatus, login))
+			if tt.currentStatus.IsFinal() {
+				mock.ExpectRollback()
+			} else if tt.updateErr != nil {
+				mock.ExpectExec(regexp.QuoteMeta(`update orders set`)).WithArgs(info.Status, info.Accrual, info.OrderID).WillReturnError(tt.updateErr)
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectExec(regexp.QuoteMeta(`update orders set`)).WithArgs(info.Status, info.Accrual, info.OrderID).WillReturnResult(sqlmock.NewResult(0, 1))
+				if tt.status == models.OrderStatusProcessed {
+					mock.ExpectExec(`insert into accounts`).WithArgs("user:test-login", login).WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectExec(`insert into ledger_entries`).WithArgs("accrual:100500", accrualAccount, -info.Accrual).WillReturnResult(sqlmock.NewResult(1, tt.postedEntries))
+					if tt.postedEntries > 0 {
+						mock.ExpectExec(`update accounts set balance`).WithArgs(-info.Accrual, accrualAccount).WillReturnResult(sqlmock.NewResult(0, 1))
+						mock.ExpectExec(`insert into ledger_entries`).WithArgs("accrual:100500", "user:test-login", info.Accrual).WillReturnResult(sqlmock.NewResult(2, 1))
+						mock.ExpectExec(`update accounts set balance`).WithArgs(info.Accrual, "user:test-login").WillReturnResult(sqlmock.NewResult(0, 1))
+					}
+				}
+				mock.ExpectExec(regexp.QuoteMeta(tt.queueQuery)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+			manager, err := New(ctx, db)
+			assert.NoError(t, err)
 
-		err = manager.UpdateOrderInfo(&info)
-		assert.EqualError(t, err, "error while updating order info: some error")
-	})
+			err = manager.UpdateOrderInfo(&info, time.Second)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
 }
 
 func TestManager_LoadOrder(t *testing.T) {
@@ -344,10 +401,6 @@ func TestManager_LoadOrder(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
 		t.Run(tt.name, func(t *testing.T) {
 			mock.ExpectQuery(regexp.QuoteMeta(`select login from orders`)).WithArgs("100500").WillReturnRows(tt.orders)
 			if errors.Is(tt.ordersErr, sql.ErrNoRows) {
@@ -375,10 +428,6 @@ func TestManager_Register(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
 		mock.ExpectExec(regexp.QuoteMeta(`insert into registered_users values`)).WillReturnResult(sqlmock.NewResult(0, 0))
 		manager, err := New(ctx, db)
 		assert.NoError(t, err)
@@ -394,10 +443,6 @@ func TestManager_Register(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
 		mock.ExpectExec(regexp.QuoteMeta(`insert into registered_users values`)).WillReturnError(ErrDublicateKey{Key: "registered_users_pkey"})
 		manager, err := New(ctx, db)
 		assert.NoError(t, err)
@@ -408,35 +453,67 @@ func TestManager_Register(t *testing.T) {
 }
 
 func TestManager_Login(t *testing.T) {
-	hash, _ := bcrypt.GenerateFromPassword([]byte("test-password"), bcrypt.DefaultCost)
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("test-password"), bcrypt.MinCost)
+	argon2idHash, _ := defaultPasswordHasher.Hash("test-password")
 
 	testCases := []struct {
 		name        string
 		login       string
 		password    string
 		creds       *sqlmock.Rows
+		rehash      bool
+		rehashErr   error
 		expectedErr error
 	}{
 		{
 			name:     "positive",
 			login:    "test-login",
 			password: "test-password",
-			creds:    sqlmock.NewRows([]string{"login", "password"}).AddRow("test-login", hash),
+			creds:    sqlmock.NewRows([]string{"password", "blocked"}).AddRow(argon2idHash, false),
+		},
+		{
+			name:     "positive: bcrypt hash is upgraded",
+			login:    "test-login",
+			password: "test-password",
+			creds:    sqlmock.NewRows([]string{"password", "blocked"}).AddRow(string(bcryptHash), false),
+			rehash:   true,
+		},
+		{
+			name:      "positive: failed upgrade is logged",
+			login:     "test-login",
+			password:  "test-password",
+			creds:     sqlmock.NewRows([]string{"password", "blocked"}).AddRow(string(bcryptHash), false),
+			rehash:    true,
+			rehashErr: errors.New("connection reset"),
 		},
 		{
 			name:        "negative: invalid creds",
 			login:       "test-login",
 			password:    "test-password",
-			creds:       sqlmock.NewRows([]string{"login", "password"}).AddRow("test-login", "wrong-pass"),
+			creds:       sqlmock.NewRows([]string{"password", "blocked"}).AddRow("wrong-pass", true),
 			expectedErr: ErrInvalidCredentials,
 		},
+		{
+			name:        "negative: blocked user",
+			login:       "test-login",
+			password:    "test-password",
+			creds:       sqlmock.NewRows([]string{"password", "blocked"}).AddRow(argon2idHash, true),
+			expectedErr: ErrUserBlocked,
+		},
 		{
 			name:        "negative: no such user",
 			login:       "test-login",
 			password:    "test-password",
-			creds:       sqlmock.NewRows([]string{"login", "password"}).AddRow("other-login", hash),
+			creds:       sqlmock.NewRows([]string{"password", "blocked"}),
 			expectedErr: ErrNoSuchUser,
 		},
+		{
+			name:        "negative: user provisioned by single sign-on",
+			login:       "test-login",
+			password:    "test-password",
+			creds:       sqlmock.NewRows([]string{"password", "blocked"}).AddRow(nil, false),
+			expectedErr: ErrInvalidCredentials,
+		},
 	}
 	for _, tt := range testCases {
 		ctx := context.Background()
@@ -446,20 +523,26 @@ func TestManager_Login(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
-
 		t.Run(tt.name, func(t *testing.T) {
-			mock.ExpectQuery(regexp.QuoteMeta(`select login, password from registered_users`)).WillReturnRows(tt.creds)
-			manager, err := New(ctx, db)
+			mock.ExpectQuery(regexp.QuoteMeta(`select password, blocked_at is not null from registered_users where login = $1`)).WithArgs(tt.login).WillReturnRows(tt.creds)
+			if tt.rehash {
+				mock.ExpectExec(regexp.QuoteMeta(`update registered_users set password = $2 where login = $1 and password = $3`)).
+					WithArgs(tt.login, sqlmock.AnyArg(), string(bcryptHash)).
+					WillReturnResult(sqlmock.NewResult(0, 1)).WillReturnError(tt.rehashErr)
+			}
+			core, logs := observer.New(zap.WarnLevel)
+			manager, err := New(ctx, db, WithLogger(zap.New(core).Sugar()))
 			assert.NoError(t, err)
 			err = manager.Login(tt.login, tt.password)
+			if tt.rehashErr != nil {
+				assert.Equal(t, 1, logs.Len())
+			}
 			if tt.expectedErr != nil {
 				assert.EqualError(t, err, tt.expectedErr.Error())
 			} else {
 				assert.NoError(t, err)
 			}
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
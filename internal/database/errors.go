@@ -14,11 +14,30 @@ func (m ErrDublicateKey) Error() string {
 }
 
 var (
-	ErrUserAlreadyExists   = errors.New("user already exists")
-	ErrCreatedBySameUser   = errors.New("order was already created by the same user")
-	ErrCreatedDiffUser     = errors.New("order was already created by the other user")
-	ErrNoData              = errors.New("no data")
-	ErrInsufficientBalance = errors.New("insufficient balance")
-	ErrNoSuchUser          = errors.New("no such user")
-	ErrInvalidCredentials  = errors.New("incorrect password")
+	ErrUserAlreadyExists     = errors.New("user already exists")
+	ErrCreatedBySameUser     = errors.New("order was already created by the same user")
+	ErrCreatedDiffUser       = errors.New("order was already created by the other user")
+	ErrNoData                = errors.New("no data")
+	ErrInsufficientBalance   = errors.New("insufficient balance")
+	ErrInvalidAmount         = errors.New("withdrawal amount must be positive")
+	ErrNoSuchUser            = errors.New("no such user")
+	ErrInvalidCredentials    = errors.New("incorrect password")
+	ErrUnbalancedTransaction = errors.New("ledger transaction is not balanced")
+	ErrUnknownMigration      = errors.New("applied migration is missing from the binary")
+	ErrSessionNotFound       = errors.New("session not found")
+	ErrSessionRevoked        = errors.New("session is revoked or expired")
+	ErrRefreshTokenReused    = errors.New("refresh token was already used")
+	ErrResetTokenInvalid     = errors.New("password reset token is invalid or expired")
+	ErrTwoFactorEnabled      = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled  = errors.New("two-factor authentication is not enrolled")
+	ErrTOTPCodeReused        = errors.New("totp code was already used")
+	ErrRecoveryCodeInvalid   = errors.New("recovery code is invalid or used")
+	ErrLoginChallengeInvalid = errors.New("login challenge is invalid, expired or exhausted")
+	ErrUserBlocked           = errors.New("user is blocked")
+	ErrNoSuchOrder           = errors.New("no such order")
+	ErrOrderIsFinal          = errors.New("order is in a final status")
+	ErrNoSuchAPIKey          = errors.New("no such api key")
+	ErrAPIKeyInvalid         = errors.New("api key is invalid, revoked or expired")
+	ErrOIDCLoginInvalid      = errors.New("oidc login is invalid, expired or already used")
+	ErrIdentityLinked        = errors.New("identity is linked to another user")
 )
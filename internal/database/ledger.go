@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+)
+
+const (
+	accrualAccount     = "system:accrual"
+	withdrawalsAccount = "system:withdrawals"
+)
+
+type ledgerEntry struct {
+	account string
+	amount  models.Money
+}
+
+func userAccount(login string) string {
+	return "user:" + login
+}
+
+func accrualTransaction(orderID string) string {
+	return "accrual:" + orderID
+}
+
+func withdrawalTransaction(orderID string) string {
+	return "withdrawal:" + orderID
+}
+
+func (m *Manager) postTransaction(tx *sql.Tx, transactionID string, entries ...ledgerEntry) (bool, error) {
+	var total models.Money
+	for _, e := range entries {
+		total += e.amount
+	}
+	if total != 0 || len(entries) < 2 {
+		return false, fmt.Errorf("%w: %s", ErrUnbalancedTransaction, transactionID)
+	}
+	insertEntry := `insert into ledger_entries (transaction_id, account_id, amount, created_at) values ($1, $2, $3, now()) on conflict (transaction_id, account_id) do nothing`
+	updateBalance := `update accounts set balance = balance + $1 where id = $2`
+	for i, e := range entries {
+		res, err := tx.Exec(insertEntry, transactionID, e.account, e.amount)
+		if err != nil {
+			return false, fmt.Errorf("error while posting ledger entry: %w", err)
+		}
+		if i == 0 {
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return false, fmt.Errorf("error while posting ledger entry: %w", err)
+			}
+			if affected == 0 {
+				return false, nil
+			}
+		}
+		if _, err = tx.Exec(updateBalance, e.amount, e.account); err != nil {
+			return false, fmt.Errorf("error while updating account balance: %w", err)
+		}
+	}
+	return true, nil
+}
+
+func (m *Manager) ensureUserAccount(tx *sql.Tx, login string) error {
+	createAccount := `insert into accounts (id, login) values ($1, $2) on conflict do nothing`
+	if _, err := tx.Exec(createAccount, userAccount(login), login); err != nil {
+		return fmt.Errorf("error while creating user account: %w", err)
+	}
+	return nil
+}
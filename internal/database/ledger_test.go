@@ -0,0 +1,28 @@
+package database
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestManager_PostTransaction(t *testing.T) {
+	t.Run("negative: unbalanced transaction", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		manager := &Manager{db: db}
+		tx, err := db.Begin()
+		assert.NoError(t, err)
+		_, err = manager.postTransaction(tx, "accrual:100500",
+			ledgerEntry{account: accrualAccount, amount: -100},
+			ledgerEntry{account: userAccount("test-login"), amount: 50},
+		)
+		assert.ErrorIs(t, err, ErrUnbalancedTransaction)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
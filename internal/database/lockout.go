@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"time"
+)
+
+func loginThrottleKey(login string) string {
+	return "login:" + login
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (m *Manager) LoginLockout(login string, ip string) (time.Duration, error) {
+	getLockout := `select coalesce(ceil(extract(epoch from max(locked_until) - now()) * 1000), 0)::bigint
+		from login_throttle where key in ($1, $2) and locked_until > now()`
+	var lockedFor int64
+	if err := m.db.QueryRow(getLockout, loginThrottleKey(login), ipThrottleKey(ip)).Scan(&lockedFor); err != nil {
+		return 0, fmt.Errorf("error while checking login lockout: %w", err)
+	}
+	return time.Duration(lockedFor) * time.Millisecond, nil
+}
+
+func (m *Manager) RecordFailedLogin(login string, ip string, loginPolicy models.LockoutPolicy, ipPolicy models.LockoutPolicy) (time.Duration, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	auditAttempt := `insert into login_attempts (login, ip, succeeded, attempted_at) values ($1, $2, false, now())`
+	if _, err = tx.Exec(auditAttempt, login, ip); err != nil {
+		return 0, fmt.Errorf("error while auditing login attempt: %w", err)
+	}
+	var lockedFor time.Duration
+	for _, subject := range []struct {
+		key    string
+		policy models.LockoutPolicy
+	}{
+		{key: loginThrottleKey(login), policy: loginPolicy},
+		{key: ipThrottleKey(ip), policy: ipPolicy},
+	} {
+		countFailure := `insert into login_throttle (key, failures, last_failure_at) values ($1, 1, now())
+			on conflict (key) do update set
+				failures = case when login_throttle.last_failure_at < now() - $2 * interval '1 millisecond' then 1 else login_throttle.failures + 1 end,
+				last_failure_at = now()
+			returning failures`
+		var failures int
+		if err = tx.QueryRow(countFailure, subject.key, subject.policy.Window.Milliseconds()).Scan(&failures); err != nil {
+			return 0, fmt.Errorf("error while counting failed login for %q: %w", subject.key, err)
+		}
+		delay := subject.policy.Delay(failures)
+		if delay == 0 {
+			continue
+		}
+		lock := `update login_throttle set locked_until = now() + $2 * interval '1 millisecond' where key = $1`
+		if _, err = tx.Exec(lock, subject.key, delay.Milliseconds()); err != nil {
+			return 0, fmt.Errorf("error while locking %q: %w", subject.key, err)
+		}
+		if delay > lockedFor {
+			lockedFor = delay
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error while committing failed login: %w", err)
+	}
+	return lockedFor, nil
+}
+
+// RecordSuccessfulLogin only clears the per-login counter: the per-IP one keeps counting,
+// so one valid account cannot be used to reset an IP that is guessing other passwords.
+func (m *Manager) RecordSuccessfulLogin(login string, ip string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	auditAttempt := `insert into login_attempts (login, ip, succeeded, attempted_at) values ($1, $2, true, now())`
+	if _, err = tx.Exec(auditAttempt, login, ip); err != nil {
+		return fmt.Errorf("error while auditing login attempt: %w", err)
+	}
+	resetFailures := `delete from login_throttle where key = $1`
+	if _, err = tx.Exec(resetFailures, loginThrottleKey(login)); err != nil {
+		return fmt.Errorf("error while resetting failed logins: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing successful login: %w", err)
+	}
+	return nil
+}
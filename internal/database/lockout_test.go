@@ -0,0 +1,70 @@
+package database
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestManager_LoginLockout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`from login_throttle where key in`).WithArgs("login:test-login", "ip:10.0.0.1").
+		WillReturnRows(sqlmock.NewRows([]string{"locked_for"}).AddRow(int64(1500)))
+
+	manager := &Manager{db: db}
+	lockedFor, err := manager.LoginLockout("test-login", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, lockedFor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_RecordFailedLogin(t *testing.T) {
+	policy := models.LockoutPolicy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, Window: 15 * time.Minute}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert into login_attempts`).WithArgs("test-login", "10.0.0.1").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`insert into login_throttle`).WithArgs("login:test-login", int64(900000)).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(7))
+	mock.ExpectExec(regexp.QuoteMeta(`update login_throttle set locked_until`)).WithArgs("login:test-login", int64(2000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`insert into login_throttle`).WithArgs("ip:10.0.0.1", int64(900000)).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+	mock.ExpectCommit()
+
+	manager := &Manager{db: db}
+	lockedFor, err := manager.RecordFailedLogin("test-login", "10.0.0.1", policy, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, lockedFor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_RecordSuccessfulLogin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert into login_attempts`).WithArgs("test-login", "10.0.0.1").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`delete from login_throttle where key = $1`)).WithArgs("login:test-login").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	manager := &Manager{db: db}
+	assert.NoError(t, manager.RecordSuccessfulLogin("test-login", "10.0.0.1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func BenchmarkManager_Login(b *testing.B) {
+	databaseURI := os.Getenv("DATABASE_URI")
+	if databaseURI == "" {
+		b.Skip("DATABASE_URI is not set")
+	}
+	const password = "bench-password"
+
+	ctx := context.Background()
+	db, err := sql.Open("pgx", databaseURI)
+	require.NoError(b, err)
+	defer db.Close()
+	// The minimal cost keeps bcrypt from hiding the cost of the lookup itself.
+	passwords, err := auth.NewPasswordHasher(auth.BcryptHasher{Cost: bcrypt.MinCost})
+	require.NoError(b, err)
+	manager, err := New(ctx, db, WithPasswordHasher(passwords))
+	require.NoError(b, err)
+	require.NoError(b, manager.MigrateUp(ctx))
+	b.Cleanup(func() {
+		_, _ = db.Exec(`delete from registered_users where login like 'bench-login-%'`)
+	})
+
+	hash, err := passwords.Hash(password)
+	require.NoError(b, err)
+	seedUsers := `insert into registered_users select 'bench-login-' || g, $1 from generate_series(1, $2::int) g on conflict do nothing`
+
+	for _, users := range []int{1_000, 10_000, 100_000} {
+		_, err = db.Exec(seedUsers, hash, users)
+		require.NoError(b, err)
+
+		b.Run(fmt.Sprintf("users=%d", users), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				login := fmt.Sprintf("bench-login-%d", rand.Intn(users)+1)
+				if err := manager.Login(login, password); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
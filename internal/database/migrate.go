@@ -0,0 +1,224 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const migrationLockID int64 = 7_264_524_301
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+func loadMigrations(files fs.FS) ([]migration, error) {
+	paths, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("error while listing migrations: %w", err)
+	}
+	byVersion := make(map[int64]*migration)
+	for _, path := range paths {
+		parts := migrationName.FindStringSubmatch(path[len("migrations/"):])
+		if parts == nil {
+			return nil, fmt.Errorf("migration %q does not match <version>_<name>.<up|down>.sql", path)
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing version of migration %q: %w", path, err)
+		}
+		body, err := fs.ReadFile(files, path)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading migration %q: %w", path, err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.name != parts[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+func (m *Manager) MigrateUp(ctx context.Context) error {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return err
+	}
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mg := range migrations {
+			if _, ok := applied[mg.version]; ok {
+				continue
+			}
+			record := `insert into schema_migrations (version, name, applied_at) values ($1, $2, $3)`
+			if err = runMigration(ctx, conn, mg.up, record, mg.version, mg.name, time.Now()); err != nil {
+				return fmt.Errorf("error while applying migration %04d_%s: %w", mg.version, mg.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Manager) MigrateDown(ctx context.Context, steps int) error {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return err
+	}
+	known := make(map[int64]migration, len(migrations))
+	for _, mg := range migrations {
+		known[mg.version] = mg
+	}
+	return m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+		for i := 0; i < steps && i < len(versions); i++ {
+			mg, ok := known[versions[i]]
+			if !ok {
+				return fmt.Errorf("error while reverting migration %d: %w", versions[i], ErrUnknownMigration)
+			}
+			record := `delete from schema_migrations where version = $1`
+			if err = runMigration(ctx, conn, mg.down, record, mg.version); err != nil {
+				return fmt.Errorf("error while reverting migration %04d_%s: %w", mg.version, mg.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Manager) MigrationStatus(ctx context.Context) ([]models.MigrationStatus, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []models.MigrationStatus
+	err = m.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		statuses = make([]models.MigrationStatus, 0, len(migrations))
+		for _, mg := range migrations {
+			status := models.MigrationStatus{Version: mg.version, Name: mg.name}
+			if appliedAt, ok := applied[mg.version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Manager) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error while acquiring connection for migrations: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("error while taking migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, migrationLockID)
+	}()
+
+	createMigrationsTable := `create table if not exists schema_migrations (version bigint primary key, name text not null, applied_at timestamp with time zone not null)`
+	if _, err = conn.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("error while trying to create table with schema migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `select version, applied_at from schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading applied migrations: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func runMigration(ctx context.Context, conn *sql.Conn, body string, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("positive: embedded migrations are ordered by version", func(t *testing.T) {
+		migrations, err := loadMigrations(migrationFiles)
+		assert.NoError(t, err)
+		for i, m := range migrations {
+			assert.Equal(t, int64(i+1), m.version)
+		}
+		assert.Equal(t, "init", migrations[0].name)
+		assert.Equal(t, "money_numeric", migrations[3].name)
+	})
+
+	t.Run("negative: migration without down file", func(t *testing.T) {
+		files := fstest.MapFS{
+			"migrations/0001_init.up.sql":   {Data: []byte("create table a (id int);")},
+			"migrations/0001_init.down.sql": {Data: []byte("drop table a;")},
+			"migrations/0002_more.up.sql":   {Data: []byte("create table b (id int);")},
+		}
+		_, err := loadMigrations(files)
+		assert.ErrorContains(t, err, "must have both up and down files")
+	})
+
+	t.Run("negative: malformed file name", func(t *testing.T) {
+		files := fstest.MapFS{
+			"migrations/init.sql": {Data: []byte("create table a (id int);")},
+		}
+		_, err := loadMigrations(files)
+		assert.ErrorContains(t, err, "does not match")
+	})
+}
+
+func expectMigrationLock(mock sqlmock.Sqlmock, applied ...int64) {
+	mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_lock($1)`)).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`create table if not exists schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range applied {
+		rows.AddRow(version, time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC))
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`select version, applied_at from schema_migrations`)).WillReturnRows(rows)
+}
+
+func embeddedMigrations(t *testing.T) ([]migration, []int64) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := make([]int64, 0, len(migrations))
+	for _, m := range migrations {
+		versions = append(versions, m.version)
+	}
+	return migrations, versions
+}
+
+func TestManager_MigrateUp(t *testing.T) {
+	migrations, versions := embeddedMigrations(t)
+	latest := migrations[len(migrations)-1]
+	previous := migrations[len(migrations)-2]
+
+	t.Run("positive: only pending migrations are applied", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectMigrationLock(mock, versions[:len(versions)-2]...)
+		for _, m := range []migration{previous, latest} {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(m.up)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`insert into schema_migrations`).WithArgs(m.version, m.name, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+		mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		manager := &Manager{db: db}
+		assert.NoError(t, manager.MigrateUp(context.Background()))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: failed migration is rolled back", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectMigrationLock(mock, versions[:len(versions)-1]...)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(latest.up)).WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+		mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		manager := &Manager{db: db}
+		err = manager.MigrateUp(context.Background())
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, fmt.Sprintf("%04d_%s", latest.version, latest.name))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestManager_MigrateDown(t *testing.T) {
+	migrations, versions := embeddedMigrations(t)
+	latest := migrations[len(migrations)-1]
+
+	t.Run("positive: latest migration is reverted", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectMigrationLock(mock, versions...)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(latest.down)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`delete from schema_migrations where version = $1`)).WithArgs(latest.version).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		manager := &Manager{db: db}
+		assert.NoError(t, manager.MigrateDown(context.Background(), 1))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: applied migration is unknown", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectMigrationLock(mock, append(versions, latest.version+1)...)
+		mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		manager := &Manager{db: db}
+		assert.ErrorIs(t, manager.MigrateDown(context.Background(), 1), ErrUnknownMigration)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestManager_MigrationStatus(t *testing.T) {
+	migrations, _ := embeddedMigrations(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectMigrationLock(mock, 1)
+	mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	manager := &Manager{db: db}
+	statuses, err := manager.MigrationStatus(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, statuses, len(migrations))
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.Equal(t, "accrual_queue", statuses[1].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,3 @@
+create table if not exists registered_users (login text primary key, password text);
+create table if not exists orders (order_id text unique, login text, uploaded_at timestamp with time zone, status text, accrual double precision, primary key(order_id));
+create table if not exists withdraw (login text, order_id text unique, processed_at timestamp with time zone, amount double precision, primary key(login, order_id));
@@ -0,0 +1,3 @@
+create table if not exists accrual_queue (order_id text primary key references orders(order_id) on delete cascade, next_check_at timestamp with time zone not null default now(), attempts integer not null default 0, last_error text);
+create index if not exists accrual_queue_next_check_at_idx on accrual_queue (next_check_at);
+insert into accrual_queue (order_id) select order_id from orders where status not in ('INVALID', 'PROCESSED') on conflict do nothing;
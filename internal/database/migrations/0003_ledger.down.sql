@@ -0,0 +1,4 @@
+drop trigger if exists ledger_entries_append_only on ledger_entries;
+drop function if exists ledger_entries_append_only();
+drop table if exists ledger_entries;
+drop table if exists accounts;
@@ -0,0 +1,30 @@
+create table if not exists accounts (id text primary key, login text unique, balance double precision not null default 0, withdrawn double precision not null default 0);
+create table if not exists ledger_entries (id bigserial primary key, transaction_id text not null, account_id text not null references accounts(id), amount double precision not null, created_at timestamp with time zone not null, unique(transaction_id, account_id));
+
+create or replace function ledger_entries_append_only() returns trigger as $$
+begin
+	raise exception 'ledger entries are append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists ledger_entries_append_only on ledger_entries;
+create trigger ledger_entries_append_only before update or delete on ledger_entries for each row execute function ledger_entries_append_only();
+
+insert into accounts (id) values ('system:accrual'), ('system:withdrawals') on conflict do nothing;
+
+insert into accounts (id, login)
+select 'user:' || login, login from (select login from orders where status = 'PROCESSED' and accrual > 0 union select login from withdraw) u
+on conflict do nothing;
+
+insert into ledger_entries (transaction_id, account_id, amount, created_at)
+select 'accrual:' || order_id, 'system:accrual', -accrual, uploaded_at from orders where status = 'PROCESSED' and accrual > 0
+union all select 'accrual:' || order_id, 'user:' || login, accrual, uploaded_at from orders where status = 'PROCESSED' and accrual > 0
+union all select 'withdrawal:' || order_id, 'user:' || login, -amount, processed_at from withdraw
+union all select 'withdrawal:' || order_id, 'system:withdrawals', amount, processed_at from withdraw
+on conflict do nothing;
+
+update accounts a set balance = s.balance, withdrawn = s.withdrawn
+from (
+	select account_id, sum(amount) as balance, -sum(case when transaction_id like 'withdrawal:%' and amount < 0 then amount else 0 end) as withdrawn
+	from ledger_entries group by account_id
+) s where a.id = s.account_id;
@@ -0,0 +1,4 @@
+alter table accounts alter column balance type double precision, alter column withdrawn type double precision;
+alter table ledger_entries alter column amount type double precision;
+alter table withdraw alter column amount type double precision;
+alter table orders alter column accrual type double precision;
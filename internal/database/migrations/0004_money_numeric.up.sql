@@ -0,0 +1,11 @@
+alter table orders alter column accrual type numeric(20,2) using round(accrual::numeric, 2);
+alter table withdraw alter column amount type numeric(20,2) using round(amount::numeric, 2);
+alter table ledger_entries alter column amount type numeric(20,2) using round(amount::numeric, 2);
+alter table accounts alter column balance type numeric(20,2) using round(balance::numeric, 2),
+	alter column withdrawn type numeric(20,2) using round(withdrawn::numeric, 2);
+
+update accounts a set balance = s.balance, withdrawn = s.withdrawn
+from (
+	select account_id, sum(amount) as balance, -sum(case when transaction_id like 'withdrawal:%' and amount < 0 then amount else 0 end) as withdrawn
+	from ledger_entries group by account_id
+) s where a.id = s.account_id;
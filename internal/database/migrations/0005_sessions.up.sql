@@ -0,0 +1,4 @@
+create table if not exists sessions (id text primary key, login text not null references registered_users(login) on delete cascade, created_at timestamp with time zone not null, expires_at timestamp with time zone not null, revoked_at timestamp with time zone);
+create index if not exists sessions_login_idx on sessions (login);
+create table if not exists refresh_tokens (token_hash text primary key, session_id text not null references sessions(id) on delete cascade, issued_at timestamp with time zone not null, used_at timestamp with time zone);
+create index if not exists refresh_tokens_session_id_idx on refresh_tokens (session_id);
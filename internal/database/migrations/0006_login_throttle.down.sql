@@ -0,0 +1,3 @@
+drop view if exists failed_login_attempts;
+drop table if exists login_attempts;
+drop table if exists login_throttle;
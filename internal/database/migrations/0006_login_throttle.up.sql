@@ -0,0 +1,5 @@
+create table if not exists login_throttle (key text primary key, failures integer not null default 0, last_failure_at timestamp with time zone not null, locked_until timestamp with time zone);
+create table if not exists login_attempts (id bigserial primary key, login text not null, ip text not null, succeeded boolean not null, attempted_at timestamp with time zone not null);
+create index if not exists login_attempts_login_idx on login_attempts (login, attempted_at);
+create index if not exists login_attempts_ip_idx on login_attempts (ip, attempted_at);
+create or replace view failed_login_attempts as select login, ip, attempted_at from login_attempts where not succeeded;
@@ -0,0 +1,2 @@
+create table if not exists password_reset_tokens (token_hash text primary key, login text not null references registered_users(login) on delete cascade, created_at timestamp with time zone not null, expires_at timestamp with time zone not null, used_at timestamp with time zone);
+create index if not exists password_reset_tokens_login_idx on password_reset_tokens (login);
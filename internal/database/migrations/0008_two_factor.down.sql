@@ -0,0 +1,3 @@
+drop table if exists login_challenges;
+drop table if exists recovery_codes;
+drop table if exists user_totp;
@@ -0,0 +1,3 @@
+create table if not exists user_totp (login text primary key references registered_users(login) on delete cascade, secret text not null, created_at timestamp with time zone not null, confirmed_at timestamp with time zone, last_used_step bigint not null default 0);
+create table if not exists recovery_codes (login text not null references registered_users(login) on delete cascade, code_hash text not null, used_at timestamp with time zone, primary key(login, code_hash));
+create table if not exists login_challenges (token_hash text primary key, login text not null references registered_users(login) on delete cascade, expires_at timestamp with time zone not null, attempts int not null default 0, used_at timestamp with time zone);
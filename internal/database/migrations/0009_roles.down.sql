@@ -0,0 +1,5 @@
+drop trigger if exists admin_audit_log_append_only on admin_audit_log;
+drop function if exists admin_audit_log_append_only();
+drop table if exists admin_audit_log;
+alter table registered_users drop column if exists blocked_at;
+drop table if exists user_roles;
@@ -0,0 +1,14 @@
+create table if not exists user_roles (login text not null references registered_users(login) on delete cascade, role text not null, primary key(login, role));
+insert into user_roles (login, role) select login, 'user' from registered_users on conflict do nothing;
+alter table registered_users add column if not exists blocked_at timestamp with time zone;
+create table if not exists admin_audit_log (id bigserial primary key, actor text not null, action text not null, target text not null, status integer not null, ip text not null, created_at timestamp with time zone not null);
+create index if not exists admin_audit_log_created_at_idx on admin_audit_log (created_at);
+
+create or replace function admin_audit_log_append_only() returns trigger as $$
+begin
+	raise exception 'admin audit log is append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists admin_audit_log_append_only on admin_audit_log;
+create trigger admin_audit_log_append_only before update or delete on admin_audit_log for each row execute function admin_audit_log_append_only();
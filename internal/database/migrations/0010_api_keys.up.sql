@@ -0,0 +1,2 @@
+create table if not exists api_keys (id text primary key, login text not null references registered_users(login) on delete cascade, name text not null, key_hash text not null unique, scopes text not null, created_at timestamp with time zone not null, expires_at timestamp with time zone not null, last_used_at timestamp with time zone, revoked_at timestamp with time zone);
+create index if not exists api_keys_login_idx on api_keys (login);
@@ -0,0 +1,2 @@
+drop table if exists oidc_logins;
+drop table if exists user_identities;
@@ -0,0 +1,3 @@
+create table if not exists user_identities (issuer text not null, subject text not null, login text not null references registered_users(login) on delete cascade, email text, linked_at timestamp with time zone not null, primary key(issuer, subject));
+create index if not exists user_identities_login_idx on user_identities (login);
+create table if not exists oidc_logins (state_hash text primary key, code_verifier text not null, nonce text not null, link_login text references registered_users(login) on delete cascade, expires_at timestamp with time zone not null, used_at timestamp with time zone);
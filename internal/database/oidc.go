@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"time"
+)
+
+func (m *Manager) CreateOIDCLogin(stateHash string, login models.OIDCLogin, expiresAt time.Time) error {
+	createLogin := `insert into oidc_logins (state_hash, code_verifier, nonce, link_login, expires_at) values ($1, $2, $3, nullif($4, ''), $5)`
+	if _, err := m.db.Exec(createLogin, stateHash, login.CodeVerifier, login.Nonce, login.LinkLogin, expiresAt); err != nil {
+		return fmt.Errorf("error while creating oidc login: %w", err)
+	}
+	return nil
+}
+
+// UseOIDCLogin consumes the pending login of the state: the callback is accepted only once.
+func (m *Manager) UseOIDCLogin(stateHash string) (models.OIDCLogin, error) {
+	useLogin := `update oidc_logins set used_at = now()
+		where state_hash = $1 and used_at is null and expires_at > now()
+		returning code_verifier, nonce, coalesce(link_login, '')`
+	var login models.OIDCLogin
+	if err := m.db.QueryRow(useLogin, stateHash).Scan(&login.CodeVerifier, &login.Nonce, &login.LinkLogin); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OIDCLogin{}, ErrOIDCLoginInvalid
+		}
+		return models.OIDCLogin{}, fmt.Errorf("error while using oidc login: %w", err)
+	}
+	return login, nil
+}
+
+// LoginWithIdentity returns the user linked to the identity, provisioning a new passwordless one
+// with the given login on the first sign-in. An existing user is never linked implicitly:
+// the login may belong to someone else, so it has to be linked with LinkIdentity.
+func (m *Manager) LoginWithIdentity(identity models.Identity, login string) (string, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var (
+		linkedLogin string
+		blocked     bool
+	)
+	getLinkedUser := `select u.login, u.blocked_at is not null from user_identities i
+		join registered_users u on u.login = i.login
+		where i.issuer = $1 and i.subject = $2`
+	err = tx.QueryRow(getLinkedUser, identity.Issuer, identity.Subject).Scan(&linkedLogin, &blocked)
+	if err == nil {
+		if blocked {
+			return "", ErrUserBlocked
+		}
+		return linkedLogin, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error while searching for identity: %w", err)
+	}
+
+	provisionUser := `insert into registered_users (login, password) values ($1, null) on conflict (login) do nothing`
+	result, err := tx.Exec(provisionUser, login)
+	if err != nil {
+		return "", fmt.Errorf("error while provisioning user %q: %w", login, err)
+	}
+	provisioned, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("error while provisioning user %q: %w", login, err)
+	}
+	if provisioned == 0 {
+		return "", ErrUserAlreadyExists
+	}
+	grantRole := `insert into user_roles (login, role) values ($1, $2)`
+	if _, err = tx.Exec(grantRole, login, models.RoleUser); err != nil {
+		return "", fmt.Errorf("error while granting role to user %q: %w", login, err)
+	}
+	linkIdentity := `insert into user_identities (issuer, subject, login, email, linked_at) values ($1, $2, $3, nullif($4, ''), now())`
+	if _, err = tx.Exec(linkIdentity, identity.Issuer, identity.Subject, login, identity.Email); err != nil {
+		return "", fmt.Errorf("error while linking identity to user %q: %w", login, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("error while committing provisioned user: %w", err)
+	}
+	return login, nil
+}
+
+// LinkIdentity is idempotent for the same user, but never moves an identity between users.
+func (m *Manager) LinkIdentity(login string, identity models.Identity) error {
+	linkIdentity := `insert into user_identities (issuer, subject, login, email, linked_at) values ($1, $2, $3, nullif($4, ''), now())
+		on conflict (issuer, subject) do update set email = excluded.email where user_identities.login = excluded.login`
+	result, err := m.db.Exec(linkIdentity, identity.Issuer, identity.Subject, login, identity.Email)
+	if err != nil {
+		return fmt.Errorf("error while linking identity to user %q: %w", login, err)
+	}
+	linked, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while linking identity to user %q: %w", login, err)
+	}
+	if linked == 0 {
+		return ErrIdentityLinked
+	}
+	return nil
+}
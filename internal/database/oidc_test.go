@@ -0,0 +1,103 @@
+package database
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestManager_LoginWithIdentity(t *testing.T) {
+	identity := models.Identity{Issuer: "https://idp.example.com", Subject: "248289761001", Email: "jane@example.com", PreferredUsername: "jane"}
+	getLinkedUser := `select u.login, u.blocked_at is not null from user_identities i`
+	provisionUser := regexp.QuoteMeta(`insert into registered_users (login, password) values ($1, null) on conflict (login) do nothing`)
+
+	testCases := []struct {
+		name          string
+		expect        func(mock sqlmock.Sqlmock)
+		expectedLogin string
+		expectedErr   error
+	}{
+		{
+			name: "positive: linked user",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(getLinkedUser).WithArgs(identity.Issuer, identity.Subject).
+					WillReturnRows(sqlmock.NewRows([]string{"login", "blocked"}).AddRow("jane-doe", false))
+				mock.ExpectRollback()
+			},
+			expectedLogin: "jane-doe",
+		},
+		{
+			name: "positive: user is provisioned",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(getLinkedUser).WithArgs(identity.Issuer, identity.Subject).
+					WillReturnRows(sqlmock.NewRows([]string{"login", "blocked"}))
+				mock.ExpectExec(provisionUser).WithArgs("jane").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(`insert into user_roles (login, role) values ($1, $2)`)).
+					WithArgs("jane", models.RoleUser).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(`insert into user_identities`)).
+					WithArgs(identity.Issuer, identity.Subject, "jane", identity.Email).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedLogin: "jane",
+		},
+		{
+			name: "negative: login is taken",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(getLinkedUser).WithArgs(identity.Issuer, identity.Subject).
+					WillReturnRows(sqlmock.NewRows([]string{"login", "blocked"}))
+				mock.ExpectExec(provisionUser).WithArgs("jane").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			expectedErr: ErrUserAlreadyExists,
+		},
+		{
+			name: "negative: blocked user",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(getLinkedUser).WithArgs(identity.Issuer, identity.Subject).
+					WillReturnRows(sqlmock.NewRows([]string{"login", "blocked"}).AddRow("jane-doe", true))
+				mock.ExpectRollback()
+			},
+			expectedErr: ErrUserBlocked,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+			tt.expect(mock)
+
+			manager := &Manager{db: db}
+			login, err := manager.LoginWithIdentity(identity, "jane")
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedLogin, login)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestManager_LinkIdentity(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	identity := models.Identity{Issuer: "https://idp.example.com", Subject: "248289761001"}
+	linkIdentity := regexp.QuoteMeta(`insert into user_identities (issuer, subject, login, email, linked_at)`)
+	mock.ExpectExec(linkIdentity).WithArgs(identity.Issuer, identity.Subject, "jane", "").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(linkIdentity).WithArgs(identity.Issuer, identity.Subject, "mallory", "").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	manager := &Manager{db: db}
+	assert.NoError(t, manager.LinkIdentity("jane", identity))
+	assert.ErrorIs(t, manager.LinkIdentity("mallory", identity), ErrIdentityLinked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
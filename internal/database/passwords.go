@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+// defaultPasswordHasher hashes with argon2id and still accepts the bcrypt hashes stored before it.
+var defaultPasswordHasher, _ = auth.NewPasswordHasher(auth.DefaultArgon2idHasher, auth.BcryptHasher{Cost: bcrypt.DefaultCost})
+
+// ChangePassword replaces the password and revokes every session of the user.
+func (m *Manager) ChangePassword(login string, password string) error {
+	hash, err := m.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = setPassword(tx, login, hash); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing password change: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) CreatePasswordReset(login string, tokenHash string, expiresAt time.Time) error {
+	createReset := `insert into password_reset_tokens (token_hash, login, created_at, expires_at)
+		select $1, login, now(), $3 from registered_users where login = $2`
+	result, err := m.db.Exec(createReset, tokenHash, login, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error while creating password reset for user %q: %w", login, err)
+	}
+	created, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while creating password reset for user %q: %w", login, err)
+	}
+	if created == 0 {
+		return ErrNoSuchUser
+	}
+	return nil
+}
+
+func (m *Manager) PasswordResetLogin(tokenHash string) (string, error) {
+	getReset := `select login from password_reset_tokens where token_hash = $1 and used_at is null and expires_at > now()`
+	var login string
+	if err := m.db.QueryRow(getReset, tokenHash).Scan(&login); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrResetTokenInvalid
+		}
+		return "", fmt.Errorf("error while searching for password reset: %w", err)
+	}
+	return login, nil
+}
+
+// ResetPassword consumes the reset token, so it cannot be replayed, and invalidates every other
+// outstanding reset token and session of the user.
+func (m *Manager) ResetPassword(tokenHash string, password string) (string, error) {
+	hash, err := m.passwords.Hash(password)
+	if err != nil {
+		return "", err
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	getReset := `select login from password_reset_tokens where token_hash = $1 and used_at is null and expires_at > now() for update`
+	var login string
+	if err = tx.QueryRow(getReset, tokenHash).Scan(&login); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrResetTokenInvalid
+		}
+		return "", fmt.Errorf("error while searching for password reset: %w", err)
+	}
+	useResets := `update password_reset_tokens set used_at = now() where login = $1 and used_at is null`
+	if _, err = tx.Exec(useResets, login); err != nil {
+		return "", fmt.Errorf("error while using password reset tokens: %w", err)
+	}
+	if err = setPassword(tx, login, hash); err != nil {
+		return "", err
+	}
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("error while committing password reset: %w", err)
+	}
+	return login, nil
+}
+
+func setPassword(tx *sql.Tx, login string, hash string) error {
+	updatePassword := `update registered_users set password = $2 where login = $1`
+	result, err := tx.Exec(updatePassword, login, hash)
+	if err != nil {
+		return fmt.Errorf("error while updating password of user %q: %w", login, err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while updating password of user %q: %w", login, err)
+	}
+	if updated == 0 {
+		return ErrNoSuchUser
+	}
+	revokeSessions := `update sessions set revoked_at = now() where login = $1 and revoked_at is null`
+	if _, err = tx.Exec(revokeSessions, login); err != nil {
+		return fmt.Errorf("error while revoking sessions of user %q: %w", login, err)
+	}
+	return nil
+}
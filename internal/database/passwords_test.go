@@ -0,0 +1,126 @@
+package database
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestManager_ChangePassword(t *testing.T) {
+	t.Run("positive: password is changed and sessions are revoked", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`update registered_users set password = $2 where login = $1`)).
+			WithArgs("test-login", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`update sessions set revoked_at = now() where login = $1`)).
+			WithArgs("test-login").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		manager := &Manager{db: db, passwords: defaultPasswordHasher}
+		assert.NoError(t, manager.ChangePassword("test-login", "s3cret-passw0rd"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: no such user", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`update registered_users set password = $2 where login = $1`)).
+			WithArgs("ghost", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		manager := &Manager{db: db, passwords: defaultPasswordHasher}
+		assert.ErrorIs(t, manager.ChangePassword("ghost", "s3cret-passw0rd"), ErrNoSuchUser)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestManager_CreatePasswordReset(t *testing.T) {
+	expiresAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("positive: reset is created", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec(`insert into password_reset_tokens`).WithArgs("reset-hash", "test-login", expiresAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		manager := &Manager{db: db}
+		assert.NoError(t, manager.CreatePasswordReset("test-login", "reset-hash", expiresAt))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: no such user", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec(`insert into password_reset_tokens`).WithArgs("reset-hash", "ghost", expiresAt).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		manager := &Manager{db: db}
+		assert.ErrorIs(t, manager.CreatePasswordReset("ghost", "reset-hash", expiresAt), ErrNoSuchUser)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestManager_ResetPassword(t *testing.T) {
+	t.Run("positive: token is consumed and password is replaced", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`select login from password_reset_tokens`).WithArgs("reset-hash").
+			WillReturnRows(sqlmock.NewRows([]string{"login"}).AddRow("test-login"))
+		mock.ExpectExec(regexp.QuoteMeta(`update password_reset_tokens set used_at = now() where login = $1`)).
+			WithArgs("test-login").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(regexp.QuoteMeta(`update registered_users set password = $2 where login = $1`)).
+			WithArgs("test-login", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`update sessions set revoked_at = now() where login = $1`)).
+			WithArgs("test-login").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		manager := &Manager{db: db, passwords: defaultPasswordHasher}
+		login, err := manager.ResetPassword("reset-hash", "s3cret-passw0rd")
+		assert.NoError(t, err)
+		assert.Equal(t, "test-login", login)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: used or expired token", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`select login from password_reset_tokens`).WithArgs("reset-hash").
+			WillReturnRows(sqlmock.NewRows([]string{"login"}))
+		mock.ExpectRollback()
+
+		manager := &Manager{db: db, passwords: defaultPasswordHasher}
+		_, err = manager.ResetPassword("reset-hash", "s3cret-passw0rd")
+		assert.ErrorIs(t, err, ErrResetTokenInvalid)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"time"
+)
+
+func (m *Manager) CreateSession(sessionID string, login string, refreshTokenHash string, expiresAt time.Time) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	createSession := `insert into sessions (id, login, created_at, expires_at) values ($1, $2, now(), $3)`
+	if _, err = tx.Exec(createSession, sessionID, login, expiresAt); err != nil {
+		return fmt.Errorf("error while creating session for user %q: %w", login, err)
+	}
+	issueRefreshToken := `insert into refresh_tokens (token_hash, session_id, issued_at) values ($1, $2, now())`
+	if _, err = tx.Exec(issueRefreshToken, refreshTokenHash, sessionID); err != nil {
+		return fmt.Errorf("error while issuing refresh token: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing session: %w", err)
+	}
+	return nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one within the same session.
+// Presenting a token that was already exchanged means it leaked, so the whole session is revoked.
+func (m *Manager) RotateRefreshToken(refreshTokenHash string, newRefreshTokenHash string) (models.Session, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return models.Session{}, fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var (
+		session        models.Session
+		used, inactive bool
+	)
+	getRefreshToken := `select s.id, s.login, s.expires_at, t.used_at is not null, s.revoked_at is not null or s.expires_at <= now()
+		from refresh_tokens t join sessions s on s.id = t.session_id
+		where t.token_hash = $1 for update`
+	if err = tx.QueryRow(getRefreshToken, refreshTokenHash).Scan(&session.ID, &session.Login, &session.ExpiresAt, &used, &inactive); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Session{}, ErrSessionNotFound
+		}
+		return models.Session{}, fmt.Errorf("error while searching for refresh token: %w", err)
+	}
+	if used {
+		revokeSession := `update sessions set revoked_at = now() where id = $1 and revoked_at is null`
+		if _, err = tx.Exec(revokeSession, session.ID); err != nil {
+			return models.Session{}, fmt.Errorf("error while revoking session %q: %w", session.ID, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return models.Session{}, fmt.Errorf("error while committing session revocation: %w", err)
+		}
+		return session, ErrRefreshTokenReused
+	}
+	if inactive {
+		return models.Session{}, ErrSessionRevoked
+	}
+	useRefreshToken := `update refresh_tokens set used_at = now() where token_hash = $1`
+	if _, err = tx.Exec(useRefreshToken, refreshTokenHash); err != nil {
+		return models.Session{}, fmt.Errorf("error while using refresh token: %w", err)
+	}
+	issueRefreshToken := `insert into refresh_tokens (token_hash, session_id, issued_at) values ($1, $2, now())`
+	if _, err = tx.Exec(issueRefreshToken, newRefreshTokenHash, session.ID); err != nil {
+		return models.Session{}, fmt.Errorf("error while issuing refresh token: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return models.Session{}, fmt.Errorf("error while committing refresh token rotation: %w", err)
+	}
+	return session, nil
+}
+
+func (m *Manager) RevokeSession(login string, sessionID string) error {
+	revokeSession := `update sessions set revoked_at = now() where id = $1 and login = $2 and revoked_at is null`
+	if _, err := m.db.Exec(revokeSession, sessionID, login); err != nil {
+		return fmt.Errorf("error while revoking session %q: %w", sessionID, err)
+	}
+	return nil
+}
+
+func (m *Manager) RevokeSessions(login string) error {
+	revokeSessions := `update sessions set revoked_at = now() where login = $1 and revoked_at is null`
+	if _, err := m.db.Exec(revokeSessions, login); err != nil {
+		return fmt.Errorf("error while revoking sessions of user %q: %w", login, err)
+	}
+	return nil
+}
+
+func (m *Manager) SessionActive(sessionID string) (bool, error) {
+	getSession := `select exists(select 1 from sessions where id = $1 and revoked_at is null and expires_at > now())`
+	var active bool
+	if err := m.db.QueryRow(getSession, sessionID).Scan(&active); err != nil {
+		return false, fmt.Errorf("error while checking session %q: %w", sessionID, err)
+	}
+	return active, nil
+}
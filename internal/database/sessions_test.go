@@ -0,0 +1,108 @@
+package database
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestManager_RotateRefreshToken(t *testing.T) {
+	expiresAt := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	tokenColumns := []string{"id", "login", "expires_at", "used", "inactive"}
+
+	t.Run("positive: token is rotated", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`from refresh_tokens t join sessions s`).WithArgs("old-hash").
+			WillReturnRows(sqlmock.NewRows(tokenColumns).AddRow("session-1", "test-login", expiresAt, false, false))
+		mock.ExpectExec(regexp.QuoteMeta(`update refresh_tokens set used_at = now() where token_hash = $1`)).WithArgs("old-hash").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`insert into refresh_tokens`).WithArgs("new-hash", "session-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		manager := &Manager{db: db}
+		session, err := manager.RotateRefreshToken("old-hash", "new-hash")
+		assert.NoError(t, err)
+		assert.Equal(t, models.Session{ID: "session-1", Login: "test-login", ExpiresAt: expiresAt}, session)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: reuse revokes the session", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`from refresh_tokens t join sessions s`).WithArgs("old-hash").
+			WillReturnRows(sqlmock.NewRows(tokenColumns).AddRow("session-1", "test-login", expiresAt, true, false))
+		mock.ExpectExec(regexp.QuoteMeta(`update sessions set revoked_at = now() where id = $1`)).WithArgs("session-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		manager := &Manager{db: db}
+		session, err := manager.RotateRefreshToken("old-hash", "new-hash")
+		assert.ErrorIs(t, err, ErrRefreshTokenReused)
+		assert.Equal(t, "session-1", session.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: revoked session", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`from refresh_tokens t join sessions s`).WithArgs("old-hash").
+			WillReturnRows(sqlmock.NewRows(tokenColumns).AddRow("session-1", "test-login", expiresAt, false, true))
+		mock.ExpectRollback()
+
+		manager := &Manager{db: db}
+		_, err = manager.RotateRefreshToken("old-hash", "new-hash")
+		assert.ErrorIs(t, err, ErrSessionRevoked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative: unknown token", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`from refresh_tokens t join sessions s`).WithArgs("old-hash").WillReturnRows(sqlmock.NewRows(tokenColumns))
+		mock.ExpectRollback()
+
+		manager := &Manager{db: db}
+		_, err = manager.RotateRefreshToken("old-hash", "new-hash")
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestManager_SessionActive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`select exists(select 1 from sessions where id = $1 and revoked_at is null and expires_at > now())`)).
+		WithArgs("session-1").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	manager := &Manager{db: db}
+	active, err := manager.SessionActive("session-1")
+	assert.NoError(t, err)
+	assert.False(t, active)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"time"
+)
+
+// EnrollTOTP stores a pending secret, replacing a previous unconfirmed one.
+// It does not touch a confirmed secret: two-factor authentication has to be disabled first.
+func (m *Manager) EnrollTOTP(login string, secret string) error {
+	enroll := `insert into user_totp (login, secret, created_at) values ($1, $2, now())
+		on conflict (login) do update set secret = excluded.secret, created_at = excluded.created_at, last_used_step = 0
+		where user_totp.confirmed_at is null`
+	result, err := m.db.Exec(enroll, login, secret)
+	if err != nil {
+		return fmt.Errorf("error while enrolling totp for user %q: %w", login, err)
+	}
+	enrolled, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while enrolling totp for user %q: %w", login, err)
+	}
+	if enrolled == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func (m *Manager) TOTPSecret(login string) (models.TOTP, error) {
+	getSecret := `select secret, confirmed_at is not null from user_totp where login = $1`
+	var totp models.TOTP
+	if err := m.db.QueryRow(getSecret, login).Scan(&totp.Secret, &totp.Confirmed); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, ErrTwoFactorNotEnrolled
+		}
+		return models.TOTP{}, fmt.Errorf("error while getting totp secret of user %q: %w", login, err)
+	}
+	return totp, nil
+}
+
+// ConfirmTOTP enables two-factor authentication and replaces the recovery codes of the user.
+func (m *Manager) ConfirmTOTP(login string, step int64, recoveryCodeHashes []string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	confirm := `update user_totp set confirmed_at = now(), last_used_step = $2 where login = $1 and confirmed_at is null`
+	result, err := tx.Exec(confirm, login, step)
+	if err != nil {
+		return fmt.Errorf("error while confirming totp for user %q: %w", login, err)
+	}
+	confirmed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while confirming totp for user %q: %w", login, err)
+	}
+	if confirmed == 0 {
+		return ErrTwoFactorNotEnrolled
+	}
+	deleteCodes := `delete from recovery_codes where login = $1`
+	if _, err = tx.Exec(deleteCodes, login); err != nil {
+		return fmt.Errorf("error while deleting recovery codes of user %q: %w", login, err)
+	}
+	insertCode := `insert into recovery_codes (login, code_hash) values ($1, $2)`
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err = tx.Exec(insertCode, login, codeHash); err != nil {
+			return fmt.Errorf("error while storing recovery code of user %q: %w", login, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing totp confirmation: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep records that the code of the given time step was used, so it cannot be replayed.
+func (m *Manager) UseTOTPStep(login string, step int64) error {
+	useStep := `update user_totp set last_used_step = $2 where login = $1 and confirmed_at is not null and last_used_step < $2`
+	result, err := m.db.Exec(useStep, login, step)
+	if err != nil {
+		return fmt.Errorf("error while using totp code of user %q: %w", login, err)
+	}
+	used, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while using totp code of user %q: %w", login, err)
+	}
+	if used == 0 {
+		return ErrTOTPCodeReused
+	}
+	return nil
+}
+
+func (m *Manager) UseRecoveryCode(login string, codeHash string) error {
+	useCode := `update recovery_codes set used_at = now() where login = $1 and code_hash = $2 and used_at is null`
+	result, err := m.db.Exec(useCode, login, codeHash)
+	if err != nil {
+		return fmt.Errorf("error while using recovery code of user %q: %w", login, err)
+	}
+	used, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while using recovery code of user %q: %w", login, err)
+	}
+	if used == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+func (m *Manager) DisableTOTP(login string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	deleteSecret := `delete from user_totp where login = $1`
+	if _, err = tx.Exec(deleteSecret, login); err != nil {
+		return fmt.Errorf("error while disabling totp for user %q: %w", login, err)
+	}
+	deleteCodes := `delete from recovery_codes where login = $1`
+	if _, err = tx.Exec(deleteCodes, login); err != nil {
+		return fmt.Errorf("error while deleting recovery codes of user %q: %w", login, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing totp removal: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) CreateLoginChallenge(login string, tokenHash string, expiresAt time.Time) error {
+	createChallenge := `insert into login_challenges (token_hash, login, expires_at) values ($1, $2, $3)`
+	if _, err := m.db.Exec(createChallenge, tokenHash, login, expiresAt); err != nil {
+		return fmt.Errorf("error while creating login challenge for user %q: %w", login, err)
+	}
+	return nil
+}
+
+// UseLoginChallenge counts an attempt to answer the challenge and returns the login it was issued for.
+// A challenge stops working after maxAttempts answers, right or wrong.
+func (m *Manager) UseLoginChallenge(tokenHash string, maxAttempts int) (string, error) {
+	useChallenge := `update login_challenges set attempts = attempts + 1
+		where token_hash = $1 and used_at is null and expires_at > now() and attempts < $2
+		returning login`
+	var login string
+	if err := m.db.QueryRow(useChallenge, tokenHash, maxAttempts).Scan(&login); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrLoginChallengeInvalid
+		}
+		return "", fmt.Errorf("error while using login challenge: %w", err)
+	}
+	return login, nil
+}
+
+func (m *Manager) CompleteLoginChallenge(tokenHash string) error {
+	completeChallenge := `update login_challenges set used_at = now() where token_hash = $1`
+	if _, err := m.db.Exec(completeChallenge, tokenHash); err != nil {
+		return fmt.Errorf("error while completing login challenge: %w", err)
+	}
+	return nil
+}
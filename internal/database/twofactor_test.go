@@ -0,0 +1,122 @@
+package database
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestManager_EnrollTOTP(t *testing.T) {
+	testCases := []struct {
+		name        string
+		enrolled    int64
+		expectedErr error
+	}{
+		{
+			name:     "positive: pending secret is stored",
+			enrolled: 1,
+		},
+		{
+			name:        "negative: already enabled",
+			enrolled:    0,
+			expectedErr: ErrTwoFactorEnabled,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectExec(`insert into user_totp`).WithArgs("test-login", "secret").WillReturnResult(sqlmock.NewResult(0, tt.enrolled))
+
+			manager := &Manager{db: db}
+			assert.ErrorIs(t, manager.EnrollTOTP("test-login", "secret"), tt.expectedErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestManager_TOTPSecret(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	getSecret := regexp.QuoteMeta(`select secret, confirmed_at is not null from user_totp where login = $1`)
+	mock.ExpectQuery(getSecret).WithArgs("test-login").
+		WillReturnRows(sqlmock.NewRows([]string{"secret", "confirmed"}).AddRow("secret", true))
+	mock.ExpectQuery(getSecret).WithArgs("ghost").WillReturnRows(sqlmock.NewRows([]string{"secret", "confirmed"}))
+
+	manager := &Manager{db: db}
+	totp, err := manager.TOTPSecret("test-login")
+	assert.NoError(t, err)
+	assert.Equal(t, models.TOTP{Secret: "secret", Confirmed: true}, totp)
+	_, err = manager.TOTPSecret("ghost")
+	assert.ErrorIs(t, err, ErrTwoFactorNotEnrolled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_ConfirmTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`update user_totp set confirmed_at = now(), last_used_step = $2`)).
+		WithArgs("test-login", int64(41152263)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`delete from recovery_codes where login = $1`)).
+		WithArgs("test-login").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`insert into recovery_codes`).WithArgs("test-login", "hash-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`insert into recovery_codes`).WithArgs("test-login", "hash-2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	manager := &Manager{db: db}
+	assert.NoError(t, manager.ConfirmTOTP("test-login", 41152263, []string{"hash-1", "hash-2"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_UseTOTPStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	useStep := regexp.QuoteMeta(`update user_totp set last_used_step = $2 where login = $1 and confirmed_at is not null and last_used_step < $2`)
+	mock.ExpectExec(useStep).WithArgs("test-login", int64(41152263)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(useStep).WithArgs("test-login", int64(41152263)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	manager := &Manager{db: db}
+	assert.NoError(t, manager.UseTOTPStep("test-login", 41152263))
+	assert.ErrorIs(t, manager.UseTOTPStep("test-login", 41152263), ErrTOTPCodeReused)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_UseLoginChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`update login_challenges set attempts = attempts \+ 1`).WithArgs("token-hash", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"login"}).AddRow("test-login"))
+	mock.ExpectQuery(`update login_challenges set attempts = attempts \+ 1`).WithArgs("token-hash", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"login"}))
+
+	manager := &Manager{db: db}
+	login, err := manager.UseLoginChallenge("token-hash", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-login", login)
+	_, err = manager.UseLoginChallenge("token-hash", 5)
+	assert.ErrorIs(t, err, ErrLoginChallengeInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
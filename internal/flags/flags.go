@@ -1,13 +1,29 @@
+// Package flags reads the configuration from command line flags and environment variables,
+// the latter taking precedence. Only -a, -d and -r, fixed by the specification, are single letters:
+// every other option has a descriptive kebab-case name and a matching environment variable.
 package flags
 
 import (
 	"flag"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
 	"os"
+	"strconv"
+	"time"
 )
 
 const (
-	defaultAddr string = "localhost:8080"
+	defaultAddr                  string        = "localhost:8080"
+	defaultAccrualWorkers        int           = 4
+	defaultAccrualRequestTimeout time.Duration = 10 * time.Second
+	defaultPasswordMinLength     int           = 8
+	defaultPasswordHash          string        = "argon2id"
+	defaultArgon2Memory          uint          = 19 * 1024
+	defaultArgon2Iterations      uint          = 2
+	defaultArgon2Parallelism     uint          = 1
+	defaultBcryptCost            int           = 10
+	defaultOIDCScopes            string        = "openid profile email"
+	defaultCompressMinSize       int           = 1024
+	defaultCompressContentTypes  string        = "application/json,text/plain"
 )
 
 func WithDatabase() models.Option {
@@ -28,6 +44,21 @@ func WithAddr() models.Option {
 	}
 }
 
+func WithCompression() models.Option {
+	return func(p *models.Config) {
+		flag.IntVar(&p.Compression.MinSize, "compress-min-size", defaultCompressMinSize, "minimal response size in bytes to compress")
+		if envMinSize := os.Getenv("COMPRESS_MIN_SIZE"); envMinSize != "" {
+			if minSize, err := strconv.Atoi(envMinSize); err == nil && minSize >= 0 {
+				p.Compression.MinSize = minSize
+			}
+		}
+		flag.StringVar(&p.Compression.ContentTypes, "compress-types", defaultCompressContentTypes, "comma separated content types of compressed responses")
+		if envContentTypes := os.Getenv("COMPRESS_CONTENT_TYPES"); envContentTypes != "" {
+			p.Compression.ContentTypes = envContentTypes
+		}
+	}
+}
+
 func WithAccrual() models.Option {
 	return func(p *models.Config) {
 		flag.StringVar(&p.AccrualSystem.Address, "r", "", "address and port to run server")
@@ -37,11 +68,132 @@ func WithAccrual() models.Option {
 	}
 }
 
+func WithAccrualWorkers() models.Option {
+	return func(p *models.Config) {
+		flag.IntVar(&p.AccrualSystem.Workers, "accrual-workers", defaultAccrualWorkers, "number of concurrent requests to accrual system")
+		if envWorkers := os.Getenv("ACCRUAL_WORKERS"); envWorkers != "" {
+			if workers, err := strconv.Atoi(envWorkers); err == nil && workers > 0 {
+				p.AccrualSystem.Workers = workers
+			}
+		}
+	}
+}
+
+func WithAccrualTimeout() models.Option {
+	return func(p *models.Config) {
+		flag.DurationVar(&p.AccrualSystem.RequestTimeout, "accrual-timeout", defaultAccrualRequestTimeout, "timeout for a single request to accrual system")
+		if envTimeout := os.Getenv("ACCRUAL_REQUEST_TIMEOUT"); envTimeout != "" {
+			if timeout, err := time.ParseDuration(envTimeout); err == nil && timeout > 0 {
+				p.AccrualSystem.RequestTimeout = timeout
+			}
+		}
+	}
+}
+
+func WithJWTKeys() models.Option {
+	return func(p *models.Config) {
+		flag.StringVar(&p.Auth.KeysFile, "jwt-keys-file", "", "path to file with jwt signing keys")
+		if envKeysFile := os.Getenv("JWT_KEYS_FILE"); envKeysFile != "" {
+			p.Auth.KeysFile = envKeysFile
+		}
+		p.Auth.Keys = os.Getenv("JWT_KEYS")
+	}
+}
+
+// WithQueryToken is off by default: tokens in urls end up in proxy and access logs,
+// so it is only meant for EventSource clients that cannot send headers.
+func WithQueryToken() models.Option {
+	return func(p *models.Config) {
+		flag.StringVar(&p.Auth.QueryTokenParam, "query-token-param", "", "query parameter to accept access tokens from, disabled when empty")
+		if envParam := os.Getenv("QUERY_TOKEN_PARAM"); envParam != "" {
+			p.Auth.QueryTokenParam = envParam
+		}
+	}
+}
+
+func WithPasswordPolicy() models.Option {
+	return func(p *models.Config) {
+		flag.IntVar(&p.Auth.PasswordMinLength, "password-min-length", defaultPasswordMinLength, "minimal password length")
+		if envMinLength := os.Getenv("PASSWORD_MIN_LENGTH"); envMinLength != "" {
+			if minLength, err := strconv.Atoi(envMinLength); err == nil && minLength > 0 {
+				p.Auth.PasswordMinLength = minLength
+			}
+		}
+		flag.StringVar(&p.Auth.PasswordDenyList, "password-denylist", "", "path to file with denied passwords, one per line")
+		if envDenyList := os.Getenv("PASSWORD_DENYLIST_FILE"); envDenyList != "" {
+			p.Auth.PasswordDenyList = envDenyList
+		}
+	}
+}
+
+func WithPasswordHashing() models.Option {
+	return func(p *models.Config) {
+		hash := &p.Auth.PasswordHash
+		flag.StringVar(&hash.Algorithm, "password-hash", defaultPasswordHash, "algorithm for new password hashes: argon2id or bcrypt")
+		if envAlgorithm := os.Getenv("PASSWORD_HASH"); envAlgorithm != "" {
+			hash.Algorithm = envAlgorithm
+		}
+		flag.UintVar(&hash.Argon2Memory, "argon2-memory", defaultArgon2Memory, "argon2id memory in KiB")
+		if envMemory := os.Getenv("ARGON2_MEMORY"); envMemory != "" {
+			if memory, err := strconv.ParseUint(envMemory, 10, 32); err == nil && memory > 0 {
+				hash.Argon2Memory = uint(memory)
+			}
+		}
+		flag.UintVar(&hash.Argon2Iterations, "argon2-iterations", defaultArgon2Iterations, "argon2id number of passes over memory")
+		if envIterations := os.Getenv("ARGON2_ITERATIONS"); envIterations != "" {
+			if iterations, err := strconv.ParseUint(envIterations, 10, 32); err == nil && iterations > 0 {
+				hash.Argon2Iterations = uint(iterations)
+			}
+		}
+		flag.UintVar(&hash.Argon2Parallelism, "argon2-parallelism", defaultArgon2Parallelism, "argon2id number of threads")
+		if envParallelism := os.Getenv("ARGON2_PARALLELISM"); envParallelism != "" {
+			if parallelism, err := strconv.ParseUint(envParallelism, 10, 8); err == nil && parallelism > 0 {
+				hash.Argon2Parallelism = uint(parallelism)
+			}
+		}
+		flag.IntVar(&hash.BcryptCost, "bcrypt-cost", defaultBcryptCost, "bcrypt cost")
+		if envCost := os.Getenv("BCRYPT_COST"); envCost != "" {
+			if cost, err := strconv.Atoi(envCost); err == nil && cost > 0 {
+				hash.BcryptCost = cost
+			}
+		}
+	}
+}
+
+// WithOIDC enables single sign-on when the issuer is set. The client secret is read
+// from the environment only, so it does not show up in the process list.
+func WithOIDC() models.Option {
+	return func(p *models.Config) {
+		oidc := &p.Auth.OIDC
+		flag.StringVar(&oidc.Issuer, "oidc-issuer", "", "openid connect issuer url, single sign-on is disabled when empty")
+		if envIssuer := os.Getenv("OIDC_ISSUER"); envIssuer != "" {
+			oidc.Issuer = envIssuer
+		}
+		flag.StringVar(&oidc.ClientID, "oidc-client-id", "", "openid connect client id")
+		if envClientID := os.Getenv("OIDC_CLIENT_ID"); envClientID != "" {
+			oidc.ClientID = envClientID
+		}
+		flag.StringVar(&oidc.RedirectURL, "oidc-redirect-url", "", "public url of /api/user/oidc/callback registered at the provider")
+		if envRedirectURL := os.Getenv("OIDC_REDIRECT_URL"); envRedirectURL != "" {
+			oidc.RedirectURL = envRedirectURL
+		}
+		flag.StringVar(&oidc.Scopes, "oidc-scopes", defaultOIDCScopes, "space separated openid connect scopes")
+		if envScopes := os.Getenv("OIDC_SCOPES"); envScopes != "" {
+			oidc.Scopes = envScopes
+		}
+		oidc.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	}
+}
+
 func Init(opts ...models.Option) *models.Config {
+	return InitArgs(os.Args[1:], opts...)
+}
+
+func InitArgs(args []string, opts ...models.Option) *models.Config {
 	p := &models.Config{}
 	for _, opt := range opts {
 		opt(p)
 	}
-	flag.Parse()
+	_ = flag.CommandLine.Parse(args)
 	return p
 }
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"net/http"
+)
+
+func (h *handler) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	login := chi.URLParam(r, "login")
+	info, err := h.db.GetUserInfo(login)
+	if err != nil {
+		h.log.Errorf("error while getting user %q: %s", login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	result, err := json.Marshal(info)
+	if err != nil {
+		h.log.Errorf("error while marshalling user info: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Write(result)
+}
+
+func (h *handler) AdminGetUserOrders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	login := chi.URLParam(r, "login")
+	userOrders, err := h.db.GetUserOrders(login)
+	if err != nil {
+		if errors.Is(err, database.ErrNoData) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.log.Errorf("error while getting orders of user %q: %s", login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Write(userOrders)
+}
+
+func (h *handler) AdminGetUserWithdrawals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	login := chi.URLParam(r, "login")
+	userWithdrawals, err := h.db.GetWithdrawals(login)
+	if err != nil {
+		if errors.Is(err, database.ErrNoData) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.log.Errorf("error while getting withdrawals of user %q: %s", login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Write(userWithdrawals)
+}
+
+func (h *handler) AdminBlockUser(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	login := chi.URLParam(r, "login")
+	if login == principal.Login {
+		h.log.Errorf("admin %q tried to block themselves", login)
+		writeProblem(w, ErrSelfBlock)
+		return
+	}
+	if err := h.db.BlockUser(login); err != nil {
+		h.log.Errorf("error while blocking user %q: %s", login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.log.Infof("user %q is blocked by %q", login, principal.Login)
+}
+
+func (h *handler) AdminUnblockUser(w http.ResponseWriter, r *http.Request) {
+	login := chi.URLParam(r, "login")
+	if err := h.db.UnblockUser(login); err != nil {
+		h.log.Errorf("error while unblocking user %q: %s", login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.log.Infof("user %q is unblocked", login)
+}
+
+func (h *handler) AdminRecheckOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "number")
+	if err := h.db.RecheckOrder(orderID); err != nil {
+		h.log.Errorf("error while scheduling recheck of order %q: %s", orderID, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func adminRouter(handler *handler) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(handler.AuditAdminActions)
+		r.Use(handler.BasicAuth)
+		r.Use(handler.RequireRole(models.RoleAdmin))
+		r.Get("/users/{login}", handler.AdminGetUser)
+		r.Post("/users/{login}/block", handler.AdminBlockUser)
+		r.Post("/orders/{number}/recheck", handler.AdminRecheckOrder)
+	})
+	return r
+}
+
+func TestHandler_Admin(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	testCases := []struct {
+		name           string
+		roles          []string
+		method         string
+		path           string
+		expect         func(manager *mockDbManager)
+		expectedActor  string
+		expectedAction string
+		expectedStatus int
+	}{
+		{
+			name:           "negative: user role is not enough",
+			roles:          []string{models.RoleUser},
+			method:         http.MethodGet,
+			path:           "/api/admin/users/test",
+			expectedActor:  "admin",
+			expectedAction: "GET /api/admin/*",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "negative: no token",
+			method:         http.MethodPost,
+			path:           "/api/admin/users/test/block",
+			expectedAction: "POST /api/admin/*",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "positive: user lookup",
+			roles:  []string{models.RoleUser, models.RoleAdmin},
+			method: http.MethodGet,
+			path:   "/api/admin/users/test",
+			expect: func(manager *mockDbManager) {
+				manager.On("GetUserInfo", "test").Return(models.UserInfo{Login: "test", Roles: []string{models.RoleUser}}, nil)
+			},
+			expectedActor:  "admin",
+			expectedAction: "GET /api/admin/users/{login}",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "positive: block user",
+			roles:  []string{models.RoleAdmin},
+			method: http.MethodPost,
+			path:   "/api/admin/users/test/block",
+			expect: func(manager *mockDbManager) {
+				manager.On("BlockUser", "test").Return(nil)
+			},
+			expectedActor:  "admin",
+			expectedAction: "POST /api/admin/users/{login}/block",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "negative: admin cannot block themselves",
+			roles:          []string{models.RoleAdmin},
+			method:         http.MethodPost,
+			path:           "/api/admin/users/admin/block",
+			expectedActor:  "admin",
+			expectedAction: "POST /api/admin/users/{login}/block",
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "negative: unknown user",
+			roles:  []string{models.RoleAdmin},
+			method: http.MethodPost,
+			path:   "/api/admin/users/ghost/block",
+			expect: func(manager *mockDbManager) {
+				manager.On("BlockUser", "ghost").Return(database.ErrNoSuchUser)
+			},
+			expectedActor:  "admin",
+			expectedAction: "POST /api/admin/users/{login}/block",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "negative: recheck of a processed order",
+			roles:  []string{models.RoleAdmin},
+			method: http.MethodPost,
+			path:   "/api/admin/orders/2377225624/recheck",
+			expect: func(manager *mockDbManager) {
+				manager.On("RecheckOrder", "2377225624").Return(database.ErrOrderIsFinal)
+			},
+			expectedActor:  "admin",
+			expectedAction: "POST /api/admin/orders/{number}/recheck",
+			expectedStatus: http.StatusConflict,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			if tt.roles != nil {
+				manager.On("SessionActive", "session-1").Return(true, nil)
+			}
+			if tt.expect != nil {
+				tt.expect(manager)
+			}
+			manager.On("RecordAdminAction", models.AuditEntry{
+				Actor:  tt.expectedActor,
+				Action: tt.expectedAction,
+				Target: tt.path,
+				Status: tt.expectedStatus,
+				IP:     "127.0.0.1",
+			}).Return(nil)
+
+			handler := New(manager, testKeyring(t), &log)
+			srv := httptest.NewServer(adminRouter(handler))
+			defer srv.Close()
+
+			request := resty.New().R()
+			if tt.roles != nil {
+				token, err := handler.createToken("admin", "session-1", tt.roles, time.Now().Add(time.Minute))
+				require.NoError(t, err)
+				request.SetHeader("Authorization", "Bearer "+token)
+			}
+			response, err := request.Execute(tt.method, srv.URL+tt.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.StatusCode())
+			if tt.expectedStatus == http.StatusOK && tt.method == http.MethodGet {
+				var info models.UserInfo
+				assert.NoError(t, json.Unmarshal(response.Body(), &info))
+				assert.Equal(t, "test", info.Login)
+			}
+		})
+	}
+}
+
+func TestHandler_Login_Blocked(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	manager := newMockDbManager(t)
+	manager.On("LoginLockout", "test", "127.0.0.1").Return(time.Duration(0), nil)
+	manager.On("Login", "test", "s3cret-passw0rd").Return(database.ErrUserBlocked)
+
+	handler := New(manager, testKeyring(t), logger.Sugar())
+	r := chi.NewRouter()
+	r.Post("/api/user/login", handler.Login)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	response, err := resty.New().R().
+		SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
+		Post(fmt.Sprintf("%s/api/user/login", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "403 Forbidden", response.Status())
+	manager.AssertNotCalled(t, "RecordFailedLogin", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAPIKeyTTL    = 90 * 24 * time.Hour
+	maxAPIKeyTTL        = 365 * 24 * time.Hour
+	maxAPIKeyNameLength = 100
+)
+
+func (h *handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	var request struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn int64    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.log.Errorf("error while unmarshalling request body: %s", err.Error())
+		writeProblem(w, fmt.Errorf("%w: %w", ErrMalformedBody, err))
+		return
+	}
+	ttl := defaultAPIKeyTTL
+	if request.ExpiresIn != 0 {
+		ttl = time.Duration(request.ExpiresIn) * time.Second
+	}
+	if err := validateAPIKeyRequest(request.Name, request.Scopes, ttl); err != nil {
+		h.log.Errorf("api key of user %q is rejected: %s", principal.Login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	id, secret, keyHash, err := auth.NewAPIKey()
+	if err != nil {
+		h.log.Errorf("error while generating api key: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	key := models.APIKey{
+		ID:        id,
+		Login:     principal.Login,
+		Name:      request.Name,
+		Scopes:    request.Scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err = h.db.CreateAPIKey(key, keyHash); err != nil {
+		h.log.Errorf("error while creating api key: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	key.Key = secret
+	result, err := json.Marshal(key)
+	if err != nil {
+		h.log.Errorf("error while marshalling api key: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(result)
+	h.log.Info(fmt.Sprintf("user %q created api key %q with scopes %v", principal.Login, id, request.Scopes))
+}
+
+func validateAPIKeyRequest(name string, scopes []string, ttl time.Duration) error {
+	if strings.TrimSpace(name) == "" || len(name) > maxAPIKeyNameLength {
+		return fmt.Errorf("%w: name must be 1 to %d characters long", ErrInvalidAPIKeyRequest, maxAPIKeyNameLength)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeyRequest)
+	}
+	for _, scope := range scopes {
+		if !models.IsKnownScope(scope) {
+			return fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKeyRequest, scope)
+		}
+	}
+	if ttl <= 0 || ttl > maxAPIKeyTTL {
+		return fmt.Errorf("%w: expiry must be within %s", ErrInvalidAPIKeyRequest, maxAPIKeyTTL)
+	}
+	return nil
+}
+
+func (h *handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	keys, err := h.db.ListAPIKeys(principal.Login)
+	if err != nil {
+		if errors.Is(err, database.ErrNoData) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.log.Errorf("error while getting api keys: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	result, err := json.Marshal(keys)
+	if err != nil {
+		h.log.Errorf("error while marshalling api keys: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Write(result)
+}
+
+func (h *handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if err := h.db.RevokeAPIKey(principal.Login, id); err != nil {
+		h.log.Errorf("error while revoking api key: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.log.Info(fmt.Sprintf("user %q revoked api key %q", principal.Login, id))
+}
+
+// apiKeyFromRequest only looks at the Authorization header: unlike session tokens,
+// API keys never travel in cookies or query strings.
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !auth.IsAPIKey(token) {
+		return "", false
+	}
+	return token, true
+}
+
+// authenticateAPIKey lets the key act as a plain user of its owner, limited to the key scopes.
+// The owner roles are loaded on every request, so revoking the user role disables the keys too.
+func (h *handler) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, apiKey string) {
+	key, err := h.db.AuthenticateAPIKey(auth.HashToken(apiKey))
+	if err != nil {
+		h.log.Errorf("error while authenticating api key: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	ownerRoles, err := h.db.UserRoles(key.Login)
+	if err != nil {
+		h.log.Errorf("error while getting roles of api key owner %q: %s", key.Login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	var roles []string
+	for _, role := range ownerRoles {
+		if role == models.RoleUser {
+			roles = append(roles, role)
+		}
+	}
+	principal := models.Principal{
+		Login:    key.Login,
+		Roles:    roles,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}
+	next.ServeHTTP(w, r.WithContext(auth.ContextWithPrincipal(r.Context(), principal)))
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAPIKey = "gm_0123456789abcdef_c2VjcmV0LXBhcnQtb2YtdGhlLWtleQ"
+
+func apiKeyRouter(handler *handler) *chi.Mux {
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(handler.BasicAuth)
+		r.Use(handler.RequireRole(models.RoleUser))
+		r.With(handler.RequireScope(models.ScopeOrdersRead)).Get("/api/user/orders", handler.GetOrders)
+		r.With(handler.RequireScope(models.ScopeBalanceRead)).Get("/api/user/balance", handler.GetBalance)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(handler.BasicAuth)
+		r.Use(handler.RequireRole(models.RoleUser))
+		r.Use(handler.RequireSession)
+		r.Post("/api/user/api-keys", handler.CreateAPIKey)
+		r.Get("/api/user/api-keys", handler.ListAPIKeys)
+		r.Delete("/api/user/api-keys/{id}", handler.RevokeAPIKey)
+	})
+	return r
+}
+
+func TestHandler_APIKeyAuth(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	key := models.APIKey{ID: "0123456789abcdef", Login: "test", Scopes: []string{models.ScopeOrdersRead}}
+	testCases := []struct {
+		name           string
+		path           string
+		method         string
+		expect         func(manager *mockDbManager)
+		expectedStatus int
+	}{
+		{
+			name:   "positive: key with the scope",
+			path:   "/api/user/orders",
+			method: http.MethodGet,
+			expect: func(manager *mockDbManager) {
+				manager.On("AuthenticateAPIKey", auth.HashToken(testAPIKey)).Return(key, nil)
+				manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil)
+				manager.On("GetUserOrders", "test").Return([]byte(`[{"number": "2377225624", "status": "NEW"}]`), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "negative: key without the scope",
+			path:   "/api/user/balance",
+			method: http.MethodGet,
+			expect: func(manager *mockDbManager) {
+				manager.On("AuthenticateAPIKey", auth.HashToken(testAPIKey)).Return(key, nil)
+				manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "negative: key cannot manage keys",
+			path:   "/api/user/api-keys",
+			method: http.MethodGet,
+			expect: func(manager *mockDbManager) {
+				manager.On("AuthenticateAPIKey", auth.HashToken(testAPIKey)).Return(key, nil)
+				manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "negative: owner lost the user role",
+			path:   "/api/user/orders",
+			method: http.MethodGet,
+			expect: func(manager *mockDbManager) {
+				manager.On("AuthenticateAPIKey", auth.HashToken(testAPIKey)).Return(key, nil)
+				manager.On("UserRoles", "test").Return([]string{}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "negative: revoked or expired key",
+			path:   "/api/user/orders",
+			method: http.MethodGet,
+			expect: func(manager *mockDbManager) {
+				manager.On("AuthenticateAPIKey", auth.HashToken(testAPIKey)).Return(models.APIKey{}, database.ErrAPIKeyInvalid)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			tt.expect(manager)
+
+			handler := New(manager, testKeyring(t), logger.Sugar())
+			srv := httptest.NewServer(apiKeyRouter(handler))
+			defer srv.Close()
+
+			response, err := resty.New().R().SetHeader("Authorization", "Bearer "+testAPIKey).
+				Execute(tt.method, srv.URL+tt.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.StatusCode())
+		})
+	}
+}
+
+func TestHandler_CreateAPIKey(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	testCases := []struct {
+		name           string
+		body           string
+		expectCreate   bool
+		expectedTTL    time.Duration
+		expectedStatus int
+	}{
+		{
+			name:           "positive: default expiry",
+			body:           `{"name": "partner", "scopes": ["orders:read", "orders:write"]}`,
+			expectCreate:   true,
+			expectedTTL:    defaultAPIKeyTTL,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "positive: custom expiry",
+			body:           `{"name": "partner", "scopes": ["balance:read"], "expires_in": 3600}`,
+			expectCreate:   true,
+			expectedTTL:    time.Hour,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "negative: unknown scope",
+			body:           `{"name": "partner", "scopes": ["admin"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative: no scopes",
+			body:           `{"name": "partner", "scopes": []}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative: expiry is too far",
+			body:           `{"name": "partner", "scopes": ["orders:read"], "expires_in": 63072000}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			manager.On("SessionActive", "session-1").Return(true, nil)
+			var keyHash string
+			if tt.expectCreate {
+				manager.On("CreateAPIKey", mock.MatchedBy(func(key models.APIKey) bool {
+					return key.Login == "test" && key.Key == "" && key.ExpiresAt.Sub(key.CreatedAt) == tt.expectedTTL
+				}), mock.Anything).Run(func(args mock.Arguments) {
+					keyHash = args.String(1)
+				}).Return(nil)
+			}
+
+			handler := New(manager, testKeyring(t), logger.Sugar())
+			srv := httptest.NewServer(apiKeyRouter(handler))
+			defer srv.Close()
+
+			token, err := handler.createToken("test", "session-1", []string{models.RoleUser}, time.Now().Add(time.Minute))
+			require.NoError(t, err)
+			response, err := resty.New().R().SetHeader("Authorization", "Bearer "+token).
+				SetBody(tt.body).Post(srv.URL + "/api/user/api-keys")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.StatusCode())
+			if tt.expectCreate {
+				var key models.APIKey
+				require.NoError(t, json.Unmarshal(response.Body(), &key))
+				assert.True(t, strings.HasPrefix(key.Key, "gm_"+key.ID+"_"))
+				assert.Equal(t, auth.HashToken(key.Key), keyHash)
+			}
+		})
+	}
+}
+
+func TestHandler_RevokeAPIKey(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	manager := newMockDbManager(t)
+	manager.On("SessionActive", "session-1").Return(true, nil)
+	manager.On("RevokeAPIKey", "test", "0123456789abcdef").Return(nil)
+	manager.On("RevokeAPIKey", "test", "unknown").Return(database.ErrNoSuchAPIKey)
+
+	handler := New(manager, testKeyring(t), logger.Sugar())
+	srv := httptest.NewServer(apiKeyRouter(handler))
+	defer srv.Close()
+
+	token, err := handler.createToken("test", "session-1", []string{models.RoleUser}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	response, err := resty.New().R().SetHeader("Authorization", "Bearer "+token).
+		Delete(srv.URL + "/api/user/api-keys/0123456789abcdef")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode())
+	response, err = resty.New().R().SetHeader("Authorization", "Bearer "+token).
+		Delete(srv.URL + "/api/user/api-keys/unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode())
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"net/http"
+)
+
+// RequireRole must be mounted after BasicAuth, which puts the principal into the request context.
+func (h *handler) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := h.principal(r)
+			if !ok {
+				writeProblem(w, ErrUnauthorized)
+				return
+			}
+			if !principal.HasRole(role) {
+				h.log.Warnf("user %q without role %q is denied %s %s", principal.Login, role, r.Method, r.URL.Path)
+				writeProblem(w, fmt.Errorf("%w: role %q is required", ErrForbidden, role))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (h *handler) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := h.principal(r)
+			if !ok {
+				writeProblem(w, ErrUnauthorized)
+				return
+			}
+			if !principal.HasScope(scope) {
+				h.log.Warnf("api key %q of user %q without scope %q is denied %s %s", principal.APIKeyID, principal.Login, scope, r.Method, r.URL.Path)
+				writeProblem(w, fmt.Errorf("%w: scope %q is required", ErrForbidden, scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession keeps API keys away from account management: only the user may change it.
+func (h *handler) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := h.principal(r)
+		if !ok {
+			writeProblem(w, ErrUnauthorized)
+			return
+		}
+		if principal.APIKeyID != "" {
+			h.log.Warnf("api key %q of user %q is denied %s %s", principal.APIKeyID, principal.Login, r.Method, r.URL.Path)
+			writeProblem(w, fmt.Errorf("%w: api keys cannot manage the account", ErrForbidden))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuditAdminActions records every admin request together with its outcome. It goes before
+// authentication and the role check, so denied attempts are recorded as well.
+//
+// Recording fails open: the row is written once the outcome is known, when the action has
+// already happened and failing the response would not undo it. The entry is logged instead,
+// so the trail can be restored from the logs.
+func (h *handler) AuditAdminActions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ctx, principal := auth.ContextWithPrincipalSink(r.Context())
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		action := r.Method + " " + r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			action = r.Method + " " + rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		entry := models.AuditEntry{
+			Actor:  principal.Login,
+			Action: action,
+			Target: r.URL.Path,
+			Status: status,
+			IP:     clientIP(r),
+		}
+		if err := h.db.RecordAdminAction(entry); err != nil {
+			h.log.Errorf("error while recording admin action %+v: %s", entry, err.Error())
+		}
+	})
+}
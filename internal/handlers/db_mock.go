@@ -2,13 +2,196 @@
 
 package handlers
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	time "time"
+
+	models "github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // mockDbManager is an autogenerated mock type for the dbManager type
 type mockDbManager struct {
 	mock.Mock
 }
 
+// AuthenticateAPIKey provides a mock function with given fields: keyHash
+func (_m *mockDbManager) AuthenticateAPIKey(keyHash string) (models.APIKey, error) {
+	ret := _m.Called(keyHash)
+
+	var r0 models.APIKey
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (models.APIKey, error)); ok {
+		return rf(keyHash)
+	}
+	if rf, ok := ret.Get(0).(func(string) models.APIKey); ok {
+		r0 = rf(keyHash)
+	} else {
+		r0 = ret.Get(0).(models.APIKey)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(keyHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BlockUser provides a mock function with given fields: login
+func (_m *mockDbManager) BlockUser(login string) error {
+	ret := _m.Called(login)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(login)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ChangePassword provides a mock function with given fields: login, password
+func (_m *mockDbManager) ChangePassword(login string, password string) error {
+	ret := _m.Called(login, password)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(login, password)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CompleteLoginChallenge provides a mock function with given fields: tokenHash
+func (_m *mockDbManager) CompleteLoginChallenge(tokenHash string) error {
+	ret := _m.Called(tokenHash)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(tokenHash)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ConfirmTOTP provides a mock function with given fields: login, step, recoveryCodeHashes
+func (_m *mockDbManager) ConfirmTOTP(login string, step int64, recoveryCodeHashes []string) error {
+	ret := _m.Called(login, step, recoveryCodeHashes)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int64, []string) error); ok {
+		r0 = rf(login, step, recoveryCodeHashes)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateAPIKey provides a mock function with given fields: key, keyHash
+func (_m *mockDbManager) CreateAPIKey(key models.APIKey, keyHash string) error {
+	ret := _m.Called(key, keyHash)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(models.APIKey, string) error); ok {
+		r0 = rf(key, keyHash)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateLoginChallenge provides a mock function with given fields: login, tokenHash, expiresAt
+func (_m *mockDbManager) CreateLoginChallenge(login string, tokenHash string, expiresAt time.Time) error {
+	ret := _m.Called(login, tokenHash, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, time.Time) error); ok {
+		r0 = rf(login, tokenHash, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateOIDCLogin provides a mock function with given fields: stateHash, login, expiresAt
+func (_m *mockDbManager) CreateOIDCLogin(stateHash string, login models.OIDCLogin, expiresAt time.Time) error {
+	ret := _m.Called(stateHash, login, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, models.OIDCLogin, time.Time) error); ok {
+		r0 = rf(stateHash, login, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreatePasswordReset provides a mock function with given fields: login, tokenHash, expiresAt
+func (_m *mockDbManager) CreatePasswordReset(login string, tokenHash string, expiresAt time.Time) error {
+	ret := _m.Called(login, tokenHash, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, time.Time) error); ok {
+		r0 = rf(login, tokenHash, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateSession provides a mock function with given fields: sessionID, login, refreshTokenHash, expiresAt
+func (_m *mockDbManager) CreateSession(sessionID string, login string, refreshTokenHash string, expiresAt time.Time) error {
+	ret := _m.Called(sessionID, login, refreshTokenHash, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string, time.Time) error); ok {
+		r0 = rf(sessionID, login, refreshTokenHash, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DisableTOTP provides a mock function with given fields: login
+func (_m *mockDbManager) DisableTOTP(login string) error {
+	ret := _m.Called(login)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(login)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EnrollTOTP provides a mock function with given fields: login, secret
+func (_m *mockDbManager) EnrollTOTP(login string, secret string) error {
+	ret := _m.Called(login, secret)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(login, secret)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetBalanceInfo provides a mock function with given fields: login
 func (_m *mockDbManager) GetBalanceInfo(login string) ([]byte, error) {
 	ret := _m.Called(login)
@@ -35,6 +218,30 @@ func (_m *mockDbManager) GetBalanceInfo(login string) ([]byte, error) {
 	return r0, r1
 }
 
+// GetUserInfo provides a mock function with given fields: login
+func (_m *mockDbManager) GetUserInfo(login string) (models.UserInfo, error) {
+	ret := _m.Called(login)
+
+	var r0 models.UserInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (models.UserInfo, error)); ok {
+		return rf(login)
+	}
+	if rf, ok := ret.Get(0).(func(string) models.UserInfo); ok {
+		r0 = rf(login)
+	} else {
+		r0 = ret.Get(0).(models.UserInfo)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserOrders provides a mock function with given fields: login
 func (_m *mockDbManager) GetUserOrders(login string) ([]byte, error) {
 	ret := _m.Called(login)
@@ -87,6 +294,46 @@ func (_m *mockDbManager) GetWithdrawals(login string) ([]byte, error) {
 	return r0, r1
 }
 
+// LinkIdentity provides a mock function with given fields: login, identity
+func (_m *mockDbManager) LinkIdentity(login string, identity models.Identity) error {
+	ret := _m.Called(login, identity)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, models.Identity) error); ok {
+		r0 = rf(login, identity)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListAPIKeys provides a mock function with given fields: login
+func (_m *mockDbManager) ListAPIKeys(login string) ([]models.APIKey, error) {
+	ret := _m.Called(login)
+
+	var r0 []models.APIKey
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) ([]models.APIKey, error)); ok {
+		return rf(login)
+	}
+	if rf, ok := ret.Get(0).(func(string) []models.APIKey); ok {
+		r0 = rf(login)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.APIKey)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // LoadOrder provides a mock function with given fields: login, orderID
 func (_m *mockDbManager) LoadOrder(login string, orderID string) error {
 	ret := _m.Called(login, orderID)
@@ -115,6 +362,144 @@ func (_m *mockDbManager) Login(login string, password string) error {
 	return r0
 }
 
+// LoginLockout provides a mock function with given fields: login, ip
+func (_m *mockDbManager) LoginLockout(login string, ip string) (time.Duration, error) {
+	ret := _m.Called(login, ip)
+
+	var r0 time.Duration
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (time.Duration, error)); ok {
+		return rf(login, ip)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) time.Duration); ok {
+		r0 = rf(login, ip)
+	} else {
+		r0 = ret.Get(0).(time.Duration)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(login, ip)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LoginWithIdentity provides a mock function with given fields: identity, login
+func (_m *mockDbManager) LoginWithIdentity(identity models.Identity, login string) (string, error) {
+	ret := _m.Called(identity, login)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(models.Identity, string) (string, error)); ok {
+		return rf(identity, login)
+	}
+	if rf, ok := ret.Get(0).(func(models.Identity, string) string); ok {
+		r0 = rf(identity, login)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(models.Identity, string) error); ok {
+		r1 = rf(identity, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PasswordResetLogin provides a mock function with given fields: tokenHash
+func (_m *mockDbManager) PasswordResetLogin(tokenHash string) (string, error) {
+	ret := _m.Called(tokenHash)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (string, error)); ok {
+		return rf(tokenHash)
+	}
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(tokenHash)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(tokenHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecheckOrder provides a mock function with given fields: orderID
+func (_m *mockDbManager) RecheckOrder(orderID string) error {
+	ret := _m.Called(orderID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(orderID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RecordAdminAction provides a mock function with given fields: entry
+func (_m *mockDbManager) RecordAdminAction(entry models.AuditEntry) error {
+	ret := _m.Called(entry)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(models.AuditEntry) error); ok {
+		r0 = rf(entry)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RecordFailedLogin provides a mock function with given fields: login, ip, loginPolicy, ipPolicy
+func (_m *mockDbManager) RecordFailedLogin(login string, ip string, loginPolicy models.LockoutPolicy, ipPolicy models.LockoutPolicy) (time.Duration, error) {
+	ret := _m.Called(login, ip, loginPolicy, ipPolicy)
+
+	var r0 time.Duration
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string, models.LockoutPolicy, models.LockoutPolicy) (time.Duration, error)); ok {
+		return rf(login, ip, loginPolicy, ipPolicy)
+	}
+	if rf, ok := ret.Get(0).(func(string, string, models.LockoutPolicy, models.LockoutPolicy) time.Duration); ok {
+		r0 = rf(login, ip, loginPolicy, ipPolicy)
+	} else {
+		r0 = ret.Get(0).(time.Duration)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string, models.LockoutPolicy, models.LockoutPolicy) error); ok {
+		r1 = rf(login, ip, loginPolicy, ipPolicy)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecordSuccessfulLogin provides a mock function with given fields: login, ip
+func (_m *mockDbManager) RecordSuccessfulLogin(login string, ip string) error {
+	ret := _m.Called(login, ip)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(login, ip)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Register provides a mock function with given fields: login, password
 func (_m *mockDbManager) Register(login string, password string) error {
 	ret := _m.Called(login, password)
@@ -129,12 +514,266 @@ func (_m *mockDbManager) Register(login string, password string) error {
 	return r0
 }
 
+// ResetPassword provides a mock function with given fields: tokenHash, password
+func (_m *mockDbManager) ResetPassword(tokenHash string, password string) (string, error) {
+	ret := _m.Called(tokenHash, password)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (string, error)); ok {
+		return rf(tokenHash, password)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(tokenHash, password)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(tokenHash, password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeAPIKey provides a mock function with given fields: login, id
+func (_m *mockDbManager) RevokeAPIKey(login string, id string) error {
+	ret := _m.Called(login, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(login, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeSession provides a mock function with given fields: login, sessionID
+func (_m *mockDbManager) RevokeSession(login string, sessionID string) error {
+	ret := _m.Called(login, sessionID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(login, sessionID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeSessions provides a mock function with given fields: login
+func (_m *mockDbManager) RevokeSessions(login string) error {
+	ret := _m.Called(login)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(login)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RotateRefreshToken provides a mock function with given fields: refreshTokenHash, newRefreshTokenHash
+func (_m *mockDbManager) RotateRefreshToken(refreshTokenHash string, newRefreshTokenHash string) (models.Session, error) {
+	ret := _m.Called(refreshTokenHash, newRefreshTokenHash)
+
+	var r0 models.Session
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (models.Session, error)); ok {
+		return rf(refreshTokenHash, newRefreshTokenHash)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) models.Session); ok {
+		r0 = rf(refreshTokenHash, newRefreshTokenHash)
+	} else {
+		r0 = ret.Get(0).(models.Session)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(refreshTokenHash, newRefreshTokenHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SessionActive provides a mock function with given fields: sessionID
+func (_m *mockDbManager) SessionActive(sessionID string) (bool, error) {
+	ret := _m.Called(sessionID)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (bool, error)); ok {
+		return rf(sessionID)
+	}
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(sessionID)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(sessionID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TOTPSecret provides a mock function with given fields: login
+func (_m *mockDbManager) TOTPSecret(login string) (models.TOTP, error) {
+	ret := _m.Called(login)
+
+	var r0 models.TOTP
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (models.TOTP, error)); ok {
+		return rf(login)
+	}
+	if rf, ok := ret.Get(0).(func(string) models.TOTP); ok {
+		r0 = rf(login)
+	} else {
+		r0 = ret.Get(0).(models.TOTP)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UnblockUser provides a mock function with given fields: login
+func (_m *mockDbManager) UnblockUser(login string) error {
+	ret := _m.Called(login)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(login)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UseLoginChallenge provides a mock function with given fields: tokenHash, maxAttempts
+func (_m *mockDbManager) UseLoginChallenge(tokenHash string, maxAttempts int) (string, error) {
+	ret := _m.Called(tokenHash, maxAttempts)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, int) (string, error)); ok {
+		return rf(tokenHash, maxAttempts)
+	}
+	if rf, ok := ret.Get(0).(func(string, int) string); ok {
+		r0 = rf(tokenHash, maxAttempts)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, int) error); ok {
+		r1 = rf(tokenHash, maxAttempts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UseOIDCLogin provides a mock function with given fields: stateHash
+func (_m *mockDbManager) UseOIDCLogin(stateHash string) (models.OIDCLogin, error) {
+	ret := _m.Called(stateHash)
+
+	var r0 models.OIDCLogin
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (models.OIDCLogin, error)); ok {
+		return rf(stateHash)
+	}
+	if rf, ok := ret.Get(0).(func(string) models.OIDCLogin); ok {
+		r0 = rf(stateHash)
+	} else {
+		r0 = ret.Get(0).(models.OIDCLogin)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(stateHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UseRecoveryCode provides a mock function with given fields: login, codeHash
+func (_m *mockDbManager) UseRecoveryCode(login string, codeHash string) error {
+	ret := _m.Called(login, codeHash)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(login, codeHash)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UseTOTPStep provides a mock function with given fields: login, step
+func (_m *mockDbManager) UseTOTPStep(login string, step int64) error {
+	ret := _m.Called(login, step)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int64) error); ok {
+		r0 = rf(login, step)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UserRoles provides a mock function with given fields: login
+func (_m *mockDbManager) UserRoles(login string) ([]string, error) {
+	ret := _m.Called(login)
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) ([]string, error)); ok {
+		return rf(login)
+	}
+	if rf, ok := ret.Get(0).(func(string) []string); ok {
+		r0 = rf(login)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Withdraw provides a mock function with given fields: login, orderID, sum
-func (_m *mockDbManager) Withdraw(login string, orderID string, sum float64) error {
+func (_m *mockDbManager) Withdraw(login string, orderID string, sum models.Money) error {
 	ret := _m.Called(login, orderID, sum)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, float64) error); ok {
+	if rf, ok := ret.Get(0).(func(string, string, models.Money) error); ok {
 		r0 = rf(login, orderID, sum)
 	} else {
 		r0 = ret.Error(0)
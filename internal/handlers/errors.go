@@ -5,4 +5,21 @@ import "errors"
 var (
 	ErrTokenIsEmpty = errors.New("token is empty")
 	ErrNoToken      = errors.New("no token")
+
+	ErrUnauthorized         = errors.New("authentication is required")
+	ErrInvalidToken         = errors.New("access token is invalid or expired")
+	ErrMalformedToken       = errors.New("access token is malformed")
+	ErrCSRFTokenInvalid     = errors.New("csrf token is missing or does not match")
+	ErrForbidden            = errors.New("not allowed to access this resource")
+	ErrMalformedBody        = errors.New("request body is malformed")
+	ErrMissingField         = errors.New("required field is missing")
+	ErrLoginFailed          = errors.New("login or password is incorrect")
+	ErrTooManyAttempts      = errors.New("too many failed attempts, try again later")
+	ErrInvalidOrderNumber   = errors.New("order number is invalid")
+	ErrInvalidCode          = errors.New("code is invalid")
+	ErrSelfBlock            = errors.New("admins cannot block themselves")
+	ErrInvalidAPIKeyRequest = errors.New("api key request is invalid")
+	ErrNotConfigured        = errors.New("feature is not configured")
+	ErrOIDCStateMismatch    = errors.New("oidc state does not match the one of the browser")
+	ErrSingleSignOnFailed   = errors.New("single sign-on failed")
 )
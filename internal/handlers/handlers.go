@@ -6,28 +6,29 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/notify"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/oidc"
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 )
 
-var jwtKey = []byte("my_secret_key")
-
 func (h *handler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
-	login, status := h.getUsernameFromToken(r)
-	if status != http.StatusOK {
-		w.WriteHeader(status)
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
 		return
 	}
+	login := principal.Login
 	userBalance, err := h.db.GetBalanceInfo(login)
 	if err != nil {
 		h.log.Errorf("error while getting user balance from db: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeProblem(w, err)
 		return
 	}
 	w.Write(userBalance)
@@ -35,11 +36,12 @@ func (h *handler) GetBalance(w http.ResponseWriter, r *http.Request) {
 
 func (h *handler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
-	login, status := h.getUsernameFromToken(r)
-	if status != http.StatusOK {
-		w.WriteHeader(status)
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
 		return
 	}
+	login := principal.Login
 	userWithdrawals, err := h.db.GetWithdrawals(login)
 	if err != nil {
 		if errors.Is(err, database.ErrNoData) {
@@ -47,7 +49,7 @@ func (h *handler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		h.log.Errorf("error while getting withdrawals from db: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeProblem(w, err)
 		return
 	}
 	w.Write(userWithdrawals)
@@ -55,47 +57,55 @@ func (h *handler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 
 func (h *handler) Withdraw(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	login := principal.Login
 	var withdrawInfo *models.WithdrawInfo
 	var buf bytes.Buffer
 	if _, err := buf.ReadFrom(r.Body); err != nil {
 		h.log.Errorf("error while reading request body: %s", err.Error())
-		w.WriteHeader(http.StatusBadRequest)
+		writeProblem(w, fmt.Errorf("%w: %w", ErrMalformedBody, err))
 		return
 	}
 	if err := json.Unmarshal(buf.Bytes(), &withdrawInfo); err != nil {
 		h.log.Errorf("error while unmarshalling request body: %s", err.Error())
-		w.WriteHeader(http.StatusBadRequest)
+		writeProblem(w, fmt.Errorf("%w: %w", ErrMalformedBody, err))
+		return
+	}
+	if withdrawInfo == nil {
+		h.log.Error("withdrawal request body is null")
+		writeProblem(w, fmt.Errorf("%w: body is null", ErrMalformedBody))
 		return
 	}
 	if !h.checkOrder(withdrawInfo.OrderID) {
 		h.log.Error("invalid order format")
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		writeProblem(w, fmt.Errorf("%w: %q fails the luhn check", ErrInvalidOrderNumber, withdrawInfo.OrderID))
 		return
 	}
-	login, status := h.getUsernameFromToken(r)
-	if status != http.StatusOK {
-		w.WriteHeader(status)
+	if withdrawInfo.Amount <= 0 {
+		h.log.Errorf("invalid withdrawal amount %s", withdrawInfo.Amount)
+		writeProblem(w, database.ErrInvalidAmount)
 		return
 	}
 	if err := h.db.Withdraw(login, withdrawInfo.OrderID, withdrawInfo.Amount); err != nil {
-		if errors.Is(err, database.ErrInsufficientBalance) {
-			w.WriteHeader(http.StatusPaymentRequired)
-			return
-		}
-		h.log.Errorf("error while trying to withdraw %f from user %q: %s", withdrawInfo.Amount, login, err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Errorf("error while trying to withdraw %s from user %q: %s", withdrawInfo.Amount, login, err.Error())
+		writeProblem(w, err)
 		return
 	}
-	h.log.Infof("withdrawn %f from user %q for order %q", withdrawInfo.Amount, login, withdrawInfo.OrderID)
+	h.log.Infof("withdrawn %s from user %q for order %q", withdrawInfo.Amount, login, withdrawInfo.OrderID)
 }
 
 func (h *handler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
-	login, status := h.getUsernameFromToken(r)
-	if status != http.StatusOK {
-		w.WriteHeader(status)
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
 		return
 	}
+	login := principal.Login
 	userOrders, err := h.db.GetUserOrders(login)
 	if err != nil {
 		if errors.Is(err, database.ErrNoData) {
@@ -103,7 +113,7 @@ func (h *handler) GetOrders(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		h.log.Errorf("error while getting orders from db: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeProblem(w, err)
 		return
 	}
 	w.Write(userOrders)
@@ -111,21 +121,22 @@ func (h *handler) GetOrders(w http.ResponseWriter, r *http.Request) {
 
 func (h *handler) LoadOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "text/plain")
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	login := principal.Login
 	var data bytes.Buffer
 	if _, err := data.ReadFrom(r.Body); err != nil {
 		h.log.Errorf("error while reading request body: %s", err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	login, status := h.getUsernameFromToken(r)
-	if status != http.StatusOK {
-		w.WriteHeader(status)
+		writeProblem(w, fmt.Errorf("%w: %w", ErrMalformedBody, err))
 		return
 	}
 	order := data.String()
 	if !h.checkOrder(order) {
 		h.log.Error("invalid order format")
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		writeProblem(w, fmt.Errorf("%w: %q fails the luhn check", ErrInvalidOrderNumber, order))
 		return
 	}
 	if err := h.db.LoadOrder(login, order); err != nil {
@@ -136,11 +147,11 @@ func (h *handler) LoadOrder(w http.ResponseWriter, r *http.Request) {
 		}
 		if errors.Is(err, database.ErrCreatedDiffUser) {
 			h.log.Info(fmt.Sprintf("order %q was alredy created by the other user", order))
-			w.WriteHeader(http.StatusConflict)
+			writeProblem(w, err)
 			return
 		}
 		h.log.Errorf("error while loading order to db: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeProblem(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusAccepted)
@@ -148,141 +159,204 @@ func (h *handler) LoadOrder(w http.ResponseWriter, r *http.Request) {
 
 func (h *handler) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
-	user, success := h.parseInputUser(r)
-	if !success {
-		w.WriteHeader(http.StatusBadRequest)
+	var request models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.log.Errorf("error while unmarshalling request body: %s", err.Error())
+		writeProblem(w, fmt.Errorf("%w: %w", ErrMalformedBody, err))
+		return
+	}
+	if request.MFAToken != "" {
+		h.completeLoginChallenge(w, r, request.MFAToken, request.Code)
+		return
+	}
+	user := request.User
+	if user.Login == "" || user.Password == "" {
+		h.log.Errorf("login or password is empty")
+		writeProblem(w, fmt.Errorf("%w: login and password are required", ErrMissingField))
+		return
+	}
+	ip := clientIP(r)
+	if locked := h.checkLoginLockout(w, user.Login, ip); locked {
 		return
 	}
 	if err := h.db.Login(user.Login, user.Password); err != nil {
 		h.log.Errorf("error while login user: %s", err.Error())
-		w.WriteHeader(http.StatusUnauthorized)
+		if errors.Is(err, database.ErrUserBlocked) {
+			writeProblem(w, err)
+			return
+		}
+		if errors.Is(err, database.ErrInvalidCredentials) || errors.Is(err, database.ErrNoSuchUser) {
+			h.recordFailedLogin(user.Login, ip)
+		}
+		// Both unknown logins and wrong passwords get the same answer, so logins cannot be probed.
+		writeProblem(w, ErrLoginFailed)
 		return
 	}
-	expirationTime := time.Now().Add(time.Hour)
-	token, err := createToken(user.Login, expirationTime)
-	if err != nil {
-		h.log.Errorf("error while create token for user: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+	h.continueLogin(w, user.Login, ip)
+}
+
+// continueLogin follows a successful first factor: users with two-factor authentication
+// get a challenge, the others get their tokens.
+func (h *handler) continueLogin(w http.ResponseWriter, login string, ip string) {
+	totp, err := h.db.TOTPSecret(login)
+	if err != nil && !errors.Is(err, database.ErrTwoFactorNotEnrolled) {
+		h.log.Errorf("error while checking two-factor authentication: %s", err.Error())
+		writeProblem(w, err)
 		return
 	}
-	w.Header().Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	http.SetCookie(w, &http.Cookie{
-		Name:    "token",
-		Value:   token,
-		Expires: expirationTime,
-	})
-	h.log.Info(fmt.Sprintf("user %q is successfully authorized", user.Login))
+	if totp.Confirmed {
+		if err = h.startLoginChallenge(w, login); err != nil {
+			h.log.Errorf("error while starting login challenge: %s", err.Error())
+			writeProblem(w, err)
+			return
+		}
+		h.log.Info(fmt.Sprintf("user %q is asked for the second factor", login))
+		return
+	}
+	h.finishLogin(w, login, ip)
+}
+
+func (h *handler) finishLogin(w http.ResponseWriter, login string, ip string) {
+	if err := h.db.RecordSuccessfulLogin(login, ip); err != nil {
+		h.log.Errorf("error while recording successful login: %s", err.Error())
+	}
+	if err := h.startSession(w, login); err != nil {
+		h.log.Errorf("error while starting session for user: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.log.Info(fmt.Sprintf("user %q is successfully authorized", login))
 }
 
 func (h *handler) Register(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
-	user, success := h.parseInputUser(r)
-	if !success {
-		w.WriteHeader(http.StatusBadRequest)
+	user, err := h.parseInputUser(r)
+	if err != nil {
+		writeProblem(w, err)
 		return
 	}
-	if err := h.db.Register(user.Login, user.Password); err != nil {
-		if errors.Is(err, database.ErrUserAlreadyExists) {
-			h.log.Errorf("login is already taken: %s", err.Error())
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
+	if err = h.passwords.Validate(user.Login, user.Password); err != nil {
+		h.log.Errorf("password of user %q is rejected: %s", user.Login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if err = h.db.Register(user.Login, user.Password); err != nil {
 		h.log.Errorf("error while register user: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeProblem(w, err)
 		return
 	}
-	if err := h.db.Login(user.Login, user.Password); err != nil {
+	if err = h.db.Login(user.Login, user.Password); err != nil {
 		h.log.Errorf("error while login user: %s", err.Error())
-		w.WriteHeader(http.StatusUnauthorized)
+		writeProblem(w, ErrLoginFailed)
 		return
 	}
-	expirationTime := time.Now().Add(time.Hour)
-	token, err := createToken(user.Login, expirationTime)
-	if err != nil {
-		h.log.Errorf("error while create token for user: %s", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+	if err = h.startSession(w, user.Login); err != nil {
+		h.log.Errorf("error while starting session for user: %s", err.Error())
+		writeProblem(w, err)
 		return
 	}
-	w.Header().Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	http.SetCookie(w, &http.Cookie{
-		Name:    "token",
-		Value:   token,
-		Expires: expirationTime,
-	})
 	h.log.Info(fmt.Sprintf("user %q is successfully registered and authorized", user.Login))
 }
 
 func (h *handler) BasicAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenHeader := r.Header.Get("Authorization")
-		if tokenHeader == "" {
-			h.log.Errorf("token is empty")
-			w.WriteHeader(http.StatusUnauthorized)
+		if apiKey, ok := apiKeyFromRequest(r); ok {
+			h.authenticateAPIKey(w, r, next, apiKey)
 			return
 		}
-		tkn, err := h.extractJwtToken(r)
+		tkn, source, err := h.extractJwtToken(r)
 		if err != nil {
+			h.log.Error(err.Error())
+			if errors.Is(err, ErrTokenIsEmpty) || errors.Is(err, ErrNoToken) {
+				writeProblem(w, err)
+				return
+			}
 			if errors.Is(err, jwt.ErrSignatureInvalid) ||
 				errors.Is(err, jwt.ErrTokenExpired) ||
-				errors.Is(err, ErrTokenIsEmpty) ||
-				errors.Is(err, ErrNoToken) {
-				h.log.Errorf(err.Error())
-				w.WriteHeader(http.StatusUnauthorized)
+				errors.Is(err, auth.ErrUnknownKey) ||
+				errors.Is(err, auth.ErrMissingKeyID) {
+				writeProblem(w, ErrInvalidToken)
 				return
 			}
-			h.log.Errorf(err.Error())
-			w.WriteHeader(http.StatusBadRequest)
+			writeProblem(w, ErrMalformedToken)
 			return
 		}
 		if !tkn.Valid {
 			h.log.Errorf("invalid token")
-			w.WriteHeader(http.StatusUnauthorized)
+			writeProblem(w, ErrInvalidToken)
 			return
 		}
-		w.Header().Add("Authorization", tokenHeader)
-		next.ServeHTTP(w, r)
+		claims, ok := tkn.Claims.(*models.Claims)
+		if !ok {
+			h.log.Errorf("error while getting claims")
+			writeProblem(w, errors.New("unexpected claims type"))
+			return
+		}
+		active, err := h.db.SessionActive(claims.SessionID)
+		if err != nil {
+			h.log.Errorf("error while checking session: %s", err.Error())
+			writeProblem(w, err)
+			return
+		}
+		if !active {
+			h.log.Errorf("session %q is revoked", claims.SessionID)
+			writeProblem(w, database.ErrSessionRevoked)
+			return
+		}
+		if source != tokenFromHeader && !isSafeMethod(r.Method) && !validCSRFToken(r) {
+			h.log.Errorf("csrf token mismatch for %s %s", r.Method, r.URL.Path)
+			writeProblem(w, ErrCSRFTokenInvalid)
+			return
+		}
+		if tokenHeader := r.Header.Get("Authorization"); tokenHeader != "" {
+			w.Header().Add("Authorization", tokenHeader)
+		}
+		principal := models.Principal{
+			Login:     claims.Username,
+			SessionID: claims.SessionID,
+			Roles:     claims.Roles,
+		}
+		next.ServeHTTP(w, r.WithContext(auth.ContextWithPrincipal(r.Context(), principal)))
 	})
 }
 
-func (h *handler) extractJwtToken(r *http.Request) (*jwt.Token, error) {
-	tokenHeader := r.Header.Get("Authorization")
-	if tokenHeader == "" {
-		h.log.Errorf("token is empty")
-		return nil, ErrTokenIsEmpty
-	}
-	splitted := strings.Split(tokenHeader, " ")
-	if len(splitted) != 2 {
-		h.log.Errorf("no token")
-		return nil, ErrNoToken
-	}
-
-	tknStr := splitted[1]
-	claims := &models.Claims{}
-	tkn, err := jwt.ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil {
-		return nil, err
+func (h *handler) extractJwtToken(r *http.Request) (*jwt.Token, tokenSource, error) {
+	for _, extractor := range h.extractors {
+		tknStr, err := extractor.extract(r)
+		if errors.Is(err, ErrTokenIsEmpty) {
+			continue
+		}
+		if err != nil {
+			h.log.Errorf("no token in %s", extractor.source)
+			return nil, extractor.source, err
+		}
+		claims := &models.Claims{}
+		tkn, err := h.keys.Parse(tknStr, claims)
+		if err != nil {
+			return nil, extractor.source, err
+		}
+		return tkn, extractor.source, nil
 	}
-	return tkn, err
+	h.log.Errorf("token is empty")
+	return nil, "", ErrTokenIsEmpty
 }
 
-func (h *handler) parseInputUser(r *http.Request) (*models.User, bool) {
+func (h *handler) parseInputUser(r *http.Request) (*models.User, error) {
 	var userFromRequest *models.User
 	var buf bytes.Buffer
 	if _, err := buf.ReadFrom(r.Body); err != nil {
 		h.log.Errorf("error while reading request body: %s", err.Error())
-		return nil, false
+		return nil, fmt.Errorf("%w: %w", ErrMalformedBody, err)
 	}
 	if err := json.Unmarshal(buf.Bytes(), &userFromRequest); err != nil {
 		h.log.Errorf("error while unmarshalling request body: %s", err.Error())
-		return nil, false
+		return nil, fmt.Errorf("%w: %w", ErrMalformedBody, err)
 	}
-	if userFromRequest.Login == "" || userFromRequest.Password == "" {
+	if userFromRequest == nil || userFromRequest.Login == "" || userFromRequest.Password == "" {
 		h.log.Errorf("login or password is empty")
-		return nil, false
+		return nil, fmt.Errorf("%w: login and password are required", ErrMissingField)
 	}
-	return userFromRequest, true
+	return userFromRequest, nil
 }
 
 func (h *handler) checkOrder(orderID string) bool {
@@ -306,57 +380,108 @@ func (h *handler) checkOrder(orderID string) bool {
 	return (orderAsInteger%10+luhn)%10 == 0
 }
 
-func (h *handler) getUsernameFromToken(r *http.Request) (string, int) {
-	var data bytes.Buffer
-	if _, err := data.ReadFrom(r.Body); err != nil {
-		h.log.Errorf("error while reading request body: %s", err.Error())
-		return "", http.StatusBadRequest
-	}
-	tkn, err := h.extractJwtToken(r)
-	if err != nil {
-		h.log.Errorf("error while extracting token: %s", err.Error())
-		return "", http.StatusInternalServerError
-	}
-	claims, ok := tkn.Claims.(*models.Claims)
+func (h *handler) principal(r *http.Request) (models.Principal, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
 	if !ok {
-		h.log.Errorf("error while getting claims")
-		return "", http.StatusInternalServerError
+		h.log.Errorf("no authenticated user in request context")
 	}
-	return claims.Username, http.StatusOK
+	return principal, ok
 }
 
-func New(db dbManager, log *zap.SugaredLogger) *handler {
-	return &handler{
-		db:  db,
-		log: log,
+func New(db dbManager, keys *auth.Keyring, log *zap.SugaredLogger, opts ...Option) *handler {
+	h := &handler{
+		db:           db,
+		keys:         keys,
+		log:          log,
+		extractors:   []tokenExtractor{headerExtractor(), cookieExtractor()},
+		loginLockout: defaultLoginLockout,
+		ipLockout:    defaultIPLockout,
+		passwords:    defaultPasswordPolicy,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+type Option func(h *handler)
+
+// WithQueryToken additionally accepts the access token from a query parameter,
+// for clients such as EventSource that can set neither headers nor cookies.
+func WithQueryToken(param string) Option {
+	return func(h *handler) {
+		h.extractors = append(h.extractors, queryExtractor(param))
 	}
 }
 
 type handler struct {
-	db  dbManager
-	log *zap.SugaredLogger
+	db           dbManager
+	keys         *auth.Keyring
+	log          *zap.SugaredLogger
+	extractors   []tokenExtractor
+	loginLockout models.LockoutPolicy
+	ipLockout    models.LockoutPolicy
+	passwords    *auth.PasswordPolicy
+	notifier     notify.Notifier
+	oidc         *oidc.Provider
 }
 
 //go:generate mockery --disable-version-string --filename db_mock.go --inpackage --name dbManager
 type dbManager interface {
 	GetBalanceInfo(login string) ([]byte, error)
 	GetWithdrawals(login string) ([]byte, error)
-	Withdraw(login string, orderID string, sum float64) error
+	Withdraw(login string, orderID string, sum models.Money) error
 	GetUserOrders(login string) ([]byte, error)
 	LoadOrder(login string, orderID string) error
 	Register(login string, password string) error
 	Login(login string, password string) error
+	CreateSession(sessionID string, login string, refreshTokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(refreshTokenHash string, newRefreshTokenHash string) (models.Session, error)
+	RevokeSession(login string, sessionID string) error
+	RevokeSessions(login string) error
+	SessionActive(sessionID string) (bool, error)
+	LoginLockout(login string, ip string) (time.Duration, error)
+	RecordFailedLogin(login string, ip string, loginPolicy models.LockoutPolicy, ipPolicy models.LockoutPolicy) (time.Duration, error)
+	RecordSuccessfulLogin(login string, ip string) error
+	ChangePassword(login string, password string) error
+	CreatePasswordReset(login string, tokenHash string, expiresAt time.Time) error
+	PasswordResetLogin(tokenHash string) (string, error)
+	ResetPassword(tokenHash string, password string) (string, error)
+	EnrollTOTP(login string, secret string) error
+	TOTPSecret(login string) (models.TOTP, error)
+	ConfirmTOTP(login string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(login string, step int64) error
+	UseRecoveryCode(login string, codeHash string) error
+	DisableTOTP(login string) error
+	CreateLoginChallenge(login string, tokenHash string, expiresAt time.Time) error
+	UseLoginChallenge(tokenHash string, maxAttempts int) (string, error)
+	CompleteLoginChallenge(tokenHash string) error
+	UserRoles(login string) ([]string, error)
+	GetUserInfo(login string) (models.UserInfo, error)
+	BlockUser(login string) error
+	UnblockUser(login string) error
+	RecheckOrder(orderID string) error
+	RecordAdminAction(entry models.AuditEntry) error
+	CreateAPIKey(key models.APIKey, keyHash string) error
+	ListAPIKeys(login string) ([]models.APIKey, error)
+	RevokeAPIKey(login string, id string) error
+	AuthenticateAPIKey(keyHash string) (models.APIKey, error)
+	CreateOIDCLogin(stateHash string, login models.OIDCLogin, expiresAt time.Time) error
+	UseOIDCLogin(stateHash string) (models.OIDCLogin, error)
+	LoginWithIdentity(identity models.Identity, login string) (string, error)
+	LinkIdentity(login string, identity models.Identity) error
 }
 
-func createToken(userName string, expirationTime time.Time) (string, error) {
+func (h *handler) createToken(userName string, sessionID string, roles []string, expirationTime time.Time) (string, error) {
 	claims := &models.Claims{
-		Username: userName,
+		Username:  userName,
+		SessionID: sessionID,
+		Roles:     roles,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := h.keys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -1,24 +1,34 @@
 package handlers
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandler_Register(t *testing.T) {
 	t.Run("positive", func(t *testing.T) {
 		manager := newMockDbManager(t)
-		manager.On("Register", "test", "test").Return(nil)
-		manager.On("Login", "test", "test").Return(nil)
+		manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		expectLogin(manager)
 		logger, err := zap.NewDevelopment()
 		if err != nil {
 			os.Exit(1)
@@ -26,7 +36,7 @@ func TestHandler_Register(t *testing.T) {
 		defer logger.Sync()
 
 		log := *logger.Sugar()
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Post("/api/user/register", handler.Register)
 
@@ -35,7 +45,7 @@ func TestHandler_Register(t *testing.T) {
 
 		jar, _ := cookiejar.New(nil)
 		response, err := resty.New().SetCookieJar(jar).R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 		assert.NoError(t, err)
 		assert.NoError(t, err)
@@ -53,7 +63,7 @@ func TestHandler_Register(t *testing.T) {
 		defer logger.Sync()
 
 		log := *logger.Sugar()
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Post("/api/user/register", handler.Register)
 
@@ -74,10 +84,10 @@ func TestHandler_Register(t *testing.T) {
 		defer logger.Sync()
 
 		manager := newMockDbManager(t)
-		manager.On("Register", "test", "test").Return(database.ErrUserAlreadyExists)
+		manager.On("Register", "test", "s3cret-passw0rd").Return(database.ErrUserAlreadyExists)
 
 		log := *logger.Sugar()
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Post("/api/user/register", handler.Register)
 
@@ -85,18 +95,45 @@ func TestHandler_Register(t *testing.T) {
 		defer srv.Close()
 
 		response, err := resty.New().R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 		assert.NoError(t, err)
 		assert.NoError(t, err)
 		assert.Equal(t, response.Status(), "409 Conflict")
 	})
+	t.Run("password is too long for the hasher", func(t *testing.T) {
+		logger, err := zap.NewDevelopment()
+		if err != nil {
+			os.Exit(1)
+		}
+		defer logger.Sync()
+
+		password := strings.Repeat("a", 73)
+		manager := newMockDbManager(t)
+		manager.On("Register", "test", password).Return(fmt.Errorf("%w: %w", auth.ErrWeakPassword, auth.ErrPasswordTooLong))
+
+		log := *logger.Sugar()
+		handler := New(manager, testKeyring(t), &log)
+		r := chi.NewRouter()
+		r.Post("/api/user/register", handler.Register)
+
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		response, err := resty.New().R().
+			SetHeader("Content-Type", "text/plain").SetBody(fmt.Sprintf(`{"login": "test", "password": %q}`, password)).
+			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, response.Status(), "400 Bad Request")
+		assert.Contains(t, response.String(), "password is too long")
+	})
 }
 
 func TestHandler_Login(t *testing.T) {
 	t.Run("positive", func(t *testing.T) {
 		manager := newMockDbManager(t)
-		manager.On("Login", "test", "test").Return(nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		expectLogin(manager)
 
 		logger, err := zap.NewDevelopment()
 		if err != nil {
@@ -105,7 +142,7 @@ func TestHandler_Login(t *testing.T) {
 		defer logger.Sync()
 
 		log := *logger.Sugar()
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Post("/api/user/login", handler.Login)
 
@@ -113,7 +150,7 @@ func TestHandler_Login(t *testing.T) {
 		defer srv.Close()
 
 		responce, err := resty.New().R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/login", srv.URL))
 		assert.NoError(t, err)
 		assert.Equal(t, responce.Status(), "200 OK")
@@ -127,7 +164,7 @@ func TestHandler_Login(t *testing.T) {
 		defer logger.Sync()
 
 		log := *logger.Sugar()
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Post("/api/user/login", handler.Login)
 
@@ -142,7 +179,9 @@ func TestHandler_Login(t *testing.T) {
 	})
 	t.Run("incorrect password", func(t *testing.T) {
 		manager := newMockDbManager(t)
+		manager.On("LoginLockout", "test", "127.0.0.1").Return(time.Duration(0), nil)
 		manager.On("Login", "test", "incorrect-password").Return(database.ErrInvalidCredentials)
+		manager.On("RecordFailedLogin", "test", "127.0.0.1", defaultLoginLockout, defaultIPLockout).Return(time.Duration(0), nil)
 		logger, err := zap.NewDevelopment()
 		if err != nil {
 			os.Exit(1)
@@ -150,7 +189,7 @@ func TestHandler_Login(t *testing.T) {
 		defer logger.Sync()
 
 		log := *logger.Sugar()
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Post("/api/user/login", handler.Login)
 
@@ -177,11 +216,12 @@ func TestHandler_LoadOrder(t *testing.T) {
 
 	t.Run("positive: new order created", func(t *testing.T) {
 		manager := newMockDbManager(t)
-		manager.On("Register", "test", "test").Return(nil)
-		manager.On("Login", "test", "test").Return(nil)
+		manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		expectLogin(manager)
 		manager.On("LoadOrder", "test", "614371538763429").Return(nil)
 
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Group(func(r chi.Router) {
 			r.Post("/api/user/register", handler.Register)
@@ -196,7 +236,7 @@ func TestHandler_LoadOrder(t *testing.T) {
 		defer srv.Close()
 
 		user, err := resty.New().R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 		assert.NoError(t, err)
 
@@ -211,11 +251,12 @@ func TestHandler_LoadOrder(t *testing.T) {
 
 	t.Run("positive: order was already created by the same user", func(t *testing.T) {
 		manager := newMockDbManager(t)
-		manager.On("Register", "test", "test").Return(nil)
-		manager.On("Login", "test", "test").Return(nil)
+		manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		expectLogin(manager)
 		manager.On("LoadOrder", "test", "614371538763429").Return(database.ErrCreatedBySameUser)
 
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Group(func(r chi.Router) {
 			r.Post("/api/user/register", handler.Register)
@@ -230,7 +271,7 @@ func TestHandler_LoadOrder(t *testing.T) {
 		defer srv.Close()
 
 		user, err := resty.New().R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 		assert.NoError(t, err)
 
@@ -245,10 +286,11 @@ func TestHandler_LoadOrder(t *testing.T) {
 
 	t.Run("negative: bad order", func(t *testing.T) {
 		manager := newMockDbManager(t)
-		manager.On("Register", "test", "test").Return(nil)
-		manager.On("Login", "test", "test").Return(nil)
+		manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		expectLogin(manager)
 
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Group(func(r chi.Router) {
 			r.Post("/api/user/register", handler.Register)
@@ -263,7 +305,7 @@ func TestHandler_LoadOrder(t *testing.T) {
 		defer srv.Close()
 
 		user, err := resty.New().R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 		assert.NoError(t, err)
 
@@ -279,7 +321,7 @@ func TestHandler_LoadOrder(t *testing.T) {
 	t.Run("negative: unauthorized", func(t *testing.T) {
 		manager := newMockDbManager(t)
 
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Group(func(r chi.Router) {
 			r.Post("/api/user/register", handler.Register)
@@ -304,11 +346,12 @@ func TestHandler_LoadOrder(t *testing.T) {
 
 	t.Run("negative: order was already created by the other user", func(t *testing.T) {
 		manager := newMockDbManager(t)
-		manager.On("Register", "test", "test").Return(nil)
-		manager.On("Login", "test", "test").Return(nil)
+		manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		expectLogin(manager)
 		manager.On("LoadOrder", "test", "614371538763429").Return(database.ErrCreatedDiffUser)
 
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Group(func(r chi.Router) {
 			r.Post("/api/user/register", handler.Register)
@@ -323,7 +366,7 @@ func TestHandler_LoadOrder(t *testing.T) {
 		defer srv.Close()
 
 		user, err := resty.New().R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 		assert.NoError(t, err)
 
@@ -347,11 +390,12 @@ func TestHandler_GetOrders(t *testing.T) {
 
 	t.Run("positive: success", func(t *testing.T) {
 		manager := newMockDbManager(t)
-		manager.On("Register", "test", "test").Return(nil)
-		manager.On("Login", "test", "test").Return(nil)
+		manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		expectLogin(manager)
 		manager.On("GetUserOrders", "test").Return([]byte(`[{"number":"1","uploaded_at":"2021-08-15T14:30:45.0000001+03:00","status":"NEW","accrual":100.5}]`), nil)
 
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Group(func(r chi.Router) {
 			r.Post("/api/user/register", handler.Register)
@@ -365,7 +409,7 @@ func TestHandler_GetOrders(t *testing.T) {
 		defer srv.Close()
 
 		user, err := resty.New().R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 		assert.NoError(t, err)
 
@@ -378,11 +422,12 @@ func TestHandler_GetOrders(t *testing.T) {
 	})
 	t.Run("positive: no data", func(t *testing.T) {
 		manager := newMockDbManager(t)
-		manager.On("Register", "test", "test").Return(nil)
-		manager.On("Login", "test", "test").Return(nil)
+		manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		expectLogin(manager)
 		manager.On("GetUserOrders", "test").Return(nil, database.ErrNoData)
 
-		handler := New(manager, &log)
+		handler := New(manager, testKeyring(t), &log)
 		r := chi.NewRouter()
 		r.Group(func(r chi.Router) {
 			r.Post("/api/user/register", handler.Register)
@@ -396,7 +441,7 @@ func TestHandler_GetOrders(t *testing.T) {
 		defer srv.Close()
 
 		user, err := resty.New().R().
-			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+			SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 			Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 		assert.NoError(t, err)
 
@@ -419,45 +464,65 @@ func TestHandler_Withdraw(t *testing.T) {
 
 	testCases := []struct {
 		name           string
-		balance        float64
+		balance        models.Money
 		order          string
-		withdraw       float64
+		withdraw       models.Money
 		expectedStatus string
+		expectedCode   string
 		errDB          error
 	}{
 		{
 			name:           "positive: success withdraw",
 			order:          "2377225624",
-			balance:        55,
-			withdraw:       20,
+			balance:        5500,
+			withdraw:       2000,
 			expectedStatus: "200 OK",
 		},
 		{
 			name:           "negative: insufficient balance",
 			order:          "2377225624",
-			balance:        20,
-			withdraw:       55,
+			balance:        2000,
+			withdraw:       5500,
 			expectedStatus: "402 Payment Required",
+			expectedCode:   "insufficient-balance",
 			errDB:          database.ErrInsufficientBalance,
 		},
 		{
 			name:           "negative: bad order num",
 			order:          "123",
-			balance:        55,
-			withdraw:       20,
+			balance:        5500,
+			withdraw:       2000,
+			expectedStatus: "422 Unprocessable Entity",
+			expectedCode:   "invalid-order-number",
+		},
+		{
+			name:           "negative: negative sum",
+			order:          "2377225624",
+			balance:        5500,
+			withdraw:       -50000,
+			expectedStatus: "422 Unprocessable Entity",
+			expectedCode:   "invalid-amount",
+		},
+		{
+			name:           "negative: zero sum",
+			order:          "2377225624",
+			balance:        5500,
+			withdraw:       0,
 			expectedStatus: "422 Unprocessable Entity",
+			expectedCode:   "invalid-amount",
 		},
 	}
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 			manager := newMockDbManager(t)
-			manager.On("Register", "test", "test").Return(nil)
-			manager.On("Login", "test", "test").Return(nil)
+			manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+			manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+			expectLogin(manager)
 			if tt.expectedStatus != "422 Unprocessable Entity" {
 				manager.On("Withdraw", "test", tt.order, tt.withdraw).Return(tt.errDB)
 			}
 
-			handler := New(manager, &log)
+			handler := New(manager, testKeyring(t), &log)
 			r := chi.NewRouter()
 			r.Group(func(r chi.Router) {
 				r.Post("/api/user/register", handler.Register)
@@ -471,19 +536,47 @@ func TestHandler_Withdraw(t *testing.T) {
 			defer srv.Close()
 
 			user, err := resty.New().R().
-				SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+				SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 				Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 			assert.NoError(t, err)
 
 			response, err := resty.New().R().
 				SetHeader("Authorization", user.Header().Get("Authorization")).
-				SetBody(fmt.Sprintf(`{"order": %q, "sum": %f}`, tt.order, tt.withdraw)).
+				SetBody(fmt.Sprintf(`{"order": %q, "sum": %s}`, tt.order, tt.withdraw)).
 				Post(fmt.Sprintf("%s/api/user/balance/withdraw", srv.URL))
 
 			assert.NoError(t, err)
 			assert.Equal(t, response.Status(), tt.expectedStatus)
+			if tt.expectedCode != "" {
+				var problem models.Problem
+				assert.NoError(t, json.Unmarshal(response.Body(), &problem))
+				assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+				assert.Equal(t, tt.expectedCode, problem.Code)
+			}
 		})
 	}
+	t.Run("null body", func(t *testing.T) {
+		manager := newMockDbManager(t)
+		expectLogin(manager)
+		handler := New(manager, testKeyring(t), &log)
+		r := chi.NewRouter()
+		r.Post("/api/user/balance/withdraw", handler.Withdraw)
+		srv := httptest.NewServer(handler.BasicAuth(r))
+		defer srv.Close()
+
+		token, err := handler.createToken("test", "session-1", []string{models.RoleUser}, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		response, err := resty.New().R().
+			SetHeader("Authorization", "Bearer "+token).
+			SetBody(`null`).
+			Post(fmt.Sprintf("%s/api/user/balance/withdraw", srv.URL))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "400 Bad Request", response.Status())
+		var problem models.Problem
+		assert.NoError(t, json.Unmarshal(response.Body(), &problem))
+		assert.Equal(t, "malformed-body", problem.Code)
+	})
 }
 
 func TestHandler_GetBalance(t *testing.T) {
@@ -514,11 +607,12 @@ func TestHandler_GetBalance(t *testing.T) {
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 			manager := newMockDbManager(t)
-			manager.On("Register", "test", "test").Return(nil)
-			manager.On("Login", "test", "test").Return(nil)
+			manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+			manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+			expectLogin(manager)
 			manager.On("GetBalanceInfo", "test").Return([]byte(tt.balanceFromDB), tt.dbErr)
 
-			handler := New(manager, &log)
+			handler := New(manager, testKeyring(t), &log)
 			r := chi.NewRouter()
 			r.Group(func(r chi.Router) {
 				r.Post("/api/user/register", handler.Register)
@@ -532,7 +626,7 @@ func TestHandler_GetBalance(t *testing.T) {
 			defer srv.Close()
 
 			user, err := resty.New().R().
-				SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+				SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 				Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 			assert.NoError(t, err)
 
@@ -582,11 +676,12 @@ func TestHandler_GetWithdrawals(t *testing.T) {
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 			manager := newMockDbManager(t)
-			manager.On("Register", "test", "test").Return(nil)
-			manager.On("Login", "test", "test").Return(nil)
+			manager.On("Register", "test", "s3cret-passw0rd").Return(nil)
+			manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+			expectLogin(manager)
 			manager.On("GetWithdrawals", "test").Return([]byte(tt.withdrawals), tt.dbErr)
 
-			handler := New(manager, &log)
+			handler := New(manager, testKeyring(t), &log)
 			r := chi.NewRouter()
 			r.Group(func(r chi.Router) {
 				r.Post("/api/user/register", handler.Register)
@@ -600,7 +695,7 @@ func TestHandler_GetWithdrawals(t *testing.T) {
 			defer srv.Close()
 
 			user, err := resty.New().R().
-				SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+				SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
 				Post(fmt.Sprintf("%s/api/user/register", srv.URL))
 			assert.NoError(t, err)
 
@@ -616,3 +711,48 @@ func TestHandler_GetWithdrawals(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_GetJWKS(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	keys, err := auth.NewKeyring(
+		auth.Key{ID: "hmac", Secret: []byte("test-secret-which-is-long-enough")},
+		auth.Key{ID: "ed-1", Signer: edKey},
+	)
+	assert.NoError(t, err)
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	handler := New(newMockDbManager(t), keys, logger.Sugar())
+	r := chi.NewRouter()
+	r.Get("/.well-known/jwks.json", handler.GetJWKS)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	response, err := resty.New().R().Get(fmt.Sprintf("%s/.well-known/jwks.json", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, response.Status(), "200 OK")
+	assert.JSONEq(t, fmt.Sprintf(`{"keys":[{"kty":"OKP","kid":"ed-1","use":"sig","alg":"EdDSA","crv":"Ed25519","x":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey))), response.String())
+}
+
+func expectLogin(manager *mockDbManager) {
+	manager.On("LoginLockout", "test", mock.Anything).Return(time.Duration(0), nil).Maybe()
+	manager.On("RecordSuccessfulLogin", "test", mock.Anything).Return(nil).Maybe()
+	manager.On("TOTPSecret", "test").Return(models.TOTP{}, database.ErrTwoFactorNotEnrolled).Maybe()
+	manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil).Maybe()
+	manager.On("CreateSession", mock.Anything, "test", mock.Anything, mock.Anything).Return(nil).Maybe()
+	manager.On("SessionActive", mock.Anything).Return(true, nil).Maybe()
+}
+
+func testKeyring(t *testing.T) *auth.Keyring {
+	keys, err := auth.NewKeyring(auth.Key{ID: "test", Secret: []byte("test-secret-which-is-long-enough")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
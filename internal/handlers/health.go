@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+func (h *healthHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	health := struct {
+		Status  string               `json:"status"`
+		Accrual models.AccrualHealth `json:"accrual"`
+	}{
+		Status:  "ok",
+		Accrual: h.accrual.Health(),
+	}
+	if health.Accrual.Circuit != models.CircuitClosed || health.Accrual.Throttle.Throttled {
+		health.Status = "degraded"
+	}
+	result, err := json.Marshal(health)
+	if err != nil {
+		h.log.Errorf("error while marshalling health info: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Write(result)
+}
+
+func NewHealth(accrual accrualHealth, log *zap.SugaredLogger) *healthHandler {
+	return &healthHandler{
+		accrual: accrual,
+		log:     log,
+	}
+}
+
+type healthHandler struct {
+	accrual accrualHealth
+	log     *zap.SugaredLogger
+}
+
+type accrualHealth interface {
+	Health() models.AccrualHealth
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (h *handler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	result, err := json.Marshal(h.keys.JWKS())
+	if err != nil {
+		h.log.Errorf("error while marshalling jwks: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(result)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	defaultLoginLockout = models.LockoutPolicy{
+		FreeAttempts: 5,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+	defaultIPLockout = models.LockoutPolicy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       15 * time.Minute,
+	}
+)
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeProblem(w, ErrTooManyAttempts)
+}
+
+// checkLoginLockout answers 429 and reports true when the login or the IP is locked out.
+func (h *handler) checkLoginLockout(w http.ResponseWriter, login string, ip string) bool {
+	lockedFor, err := h.db.LoginLockout(login, ip)
+	if err != nil {
+		h.log.Errorf("error while checking login lockout: %s", err.Error())
+		writeProblem(w, err)
+		return true
+	}
+	if lockedFor > 0 {
+		h.log.Warnf("login of user %q from %s is locked for %s", login, ip, lockedFor)
+		writeTooManyRequests(w, lockedFor)
+		return true
+	}
+	return false
+}
+
+func (h *handler) recordFailedLogin(login string, ip string) {
+	lockedFor, err := h.db.RecordFailedLogin(login, ip, h.loginLockout, h.ipLockout)
+	if err != nil {
+		h.log.Errorf("error while recording failed login: %s", err.Error())
+	} else if lockedFor > 0 {
+		h.log.Warnf("login of user %q from %s is locked for %s after repeated failures", login, ip, lockedFor)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandler_Login_Lockout(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	t.Run("negative: locked login gets 429 with Retry-After", func(t *testing.T) {
+		manager := newMockDbManager(t)
+		manager.On("LoginLockout", "test", "127.0.0.1").Return(2500*time.Millisecond, nil)
+
+		handler := New(manager, testKeyring(t), &log)
+		r := chi.NewRouter()
+		r.Post("/api/user/login", handler.Login)
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		response, err := resty.New().R().
+			SetBody(`{"login": "test", "password": "test"}`).
+			Post(fmt.Sprintf("%s/api/user/login", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, "429 Too Many Requests", response.Status())
+		assert.Equal(t, "3", response.Header().Get("Retry-After"))
+		manager.AssertNotCalled(t, "Login", "test", "test")
+	})
+
+	t.Run("negative: unknown user is counted as a failure", func(t *testing.T) {
+		manager := newMockDbManager(t)
+		manager.On("LoginLockout", "ghost", "127.0.0.1").Return(time.Duration(0), nil)
+		manager.On("Login", "ghost", "test").Return(database.ErrNoSuchUser)
+		manager.On("RecordFailedLogin", "ghost", "127.0.0.1", defaultLoginLockout, defaultIPLockout).Return(time.Second, nil)
+
+		handler := New(manager, testKeyring(t), &log)
+		r := chi.NewRouter()
+		r.Post("/api/user/login", handler.Login)
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		response, err := resty.New().R().
+			SetBody(`{"login": "ghost", "password": "test"}`).
+			Post(fmt.Sprintf("%s/api/user/login", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, "401 Unauthorized", response.Status())
+	})
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/oidc"
+	"net/http"
+	"time"
+)
+
+const (
+	oidcLoginTTL    = 10 * time.Minute
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/user/oidc"
+)
+
+func WithOIDC(provider *oidc.Provider) Option {
+	return func(h *handler) {
+		h.oidc = provider
+	}
+}
+
+// OIDCLogin sends the browser to the identity provider, which redirects it back to OIDCCallback.
+func (h *handler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		h.log.Errorf("single sign-on is requested, but no identity provider is configured")
+		writeProblem(w, fmt.Errorf("%w: single sign-on", ErrNotConfigured))
+		return
+	}
+	authURL, err := h.startOIDCLogin(w, "")
+	if err != nil {
+		h.log.Errorf("error while starting oidc login: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// LinkOIDC starts the same flow for a signed-in user, so that the identity gets linked
+// to their account. The client navigates to the returned url itself.
+func (h *handler) LinkOIDC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	if h.oidc == nil {
+		h.log.Errorf("identity linking is requested, but no identity provider is configured")
+		writeProblem(w, fmt.Errorf("%w: single sign-on", ErrNotConfigured))
+		return
+	}
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	authURL, err := h.startOIDCLogin(w, principal.Login)
+	if err != nil {
+		h.log.Errorf("error while starting oidc login: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	result, err := json.Marshal(models.OIDCAuthorization{AuthorizationURL: authURL})
+	if err != nil {
+		h.log.Errorf("error while marshalling authorization url: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Write(result)
+}
+
+func (h *handler) startOIDCLogin(w http.ResponseWriter, linkLogin string) (string, error) {
+	state, stateHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := auth.NewRandomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+	login := models.OIDCLogin{CodeVerifier: verifier, Nonce: nonce, LinkLogin: linkLogin}
+	if err = h.db.CreateOIDCLogin(stateHash, login, time.Now().Add(oidcLoginTTL)); err != nil {
+		return "", err
+	}
+	// The state is also kept in a cookie, so the callback is accepted only in the browser that
+	// started the login and nobody can slip their own account into someone else's browser.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return h.oidc.AuthCodeURL(state, nonce, challenge), nil
+}
+
+func (h *handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	if h.oidc == nil {
+		h.log.Errorf("oidc callback is requested, but no identity provider is configured")
+		writeProblem(w, fmt.Errorf("%w: single sign-on", ErrNotConfigured))
+		return
+	}
+	query := r.URL.Query()
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	clearOIDCStateCookie(w)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		h.log.Errorf("oidc callback state does not match the one of the browser")
+		writeProblem(w, ErrOIDCStateMismatch)
+		return
+	}
+	pending, err := h.db.UseOIDCLogin(auth.HashToken(state))
+	if err != nil {
+		h.log.Errorf("error while completing oidc login: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if providerErr := query.Get("error"); providerErr != "" {
+		h.log.Errorf("identity provider declined the login: %s %s", providerErr, query.Get("error_description"))
+		writeProblem(w, fmt.Errorf("%w: identity provider answered %q", ErrSingleSignOnFailed, providerErr))
+		return
+	}
+	identity, err := h.oidc.Exchange(r.Context(), query.Get("code"), pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		h.log.Errorf("error while exchanging authorization code: %s", err.Error())
+		writeProblem(w, ErrSingleSignOnFailed)
+		return
+	}
+	if pending.LinkLogin != "" {
+		h.linkIdentity(w, pending.LinkLogin, identity)
+		return
+	}
+	login, err := h.db.LoginWithIdentity(identity, identityLogin(identity))
+	if err != nil {
+		h.log.Errorf("error while login user with identity %q of %q: %s", identity.Subject, identity.Issuer, err.Error())
+		if errors.Is(err, database.ErrUserAlreadyExists) {
+			// The login is taken by a user who has not linked this identity: they have to sign in
+			// with their password and link it first.
+			err = fmt.Errorf("%w: sign in with your password and link the identity first", err)
+		}
+		writeProblem(w, err)
+		return
+	}
+	h.continueLogin(w, login, clientIP(r))
+}
+
+func (h *handler) linkIdentity(w http.ResponseWriter, login string, identity models.Identity) {
+	if err := h.db.LinkIdentity(login, identity); err != nil {
+		h.log.Errorf("error while linking identity to user %q: %s", login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.log.Info(fmt.Sprintf("identity %q of %q is linked to user %q", identity.Subject, identity.Issuer, login))
+}
+
+// identityLogin is the login of a provisioned user: the username the provider suggests,
+// then the email if the provider has verified it, then the subject.
+func identityLogin(identity models.Identity) string {
+	switch {
+	case identity.PreferredUsername != "":
+		return identity.PreferredUsername
+	case identity.Email != "" && identity.EmailVerified:
+		return identity.Email
+	default:
+		return identity.Subject
+	}
+}
+
+func clearOIDCStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/oidc"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var noRedirects = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+// expectOIDCLogins keeps pending logins like the database would, single use included.
+func expectOIDCLogins(manager *mockDbManager) {
+	var (
+		mu      sync.Mutex
+		pending = make(map[string]models.OIDCLogin)
+	)
+	manager.On("CreateOIDCLogin", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		pending[args.String(0)] = args.Get(1).(models.OIDCLogin)
+	}).Return(nil).Maybe()
+	manager.On("UseOIDCLogin", mock.Anything).Return(func(stateHash string) (models.OIDCLogin, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		login, ok := pending[stateHash]
+		if !ok {
+			return models.OIDCLogin{}, database.ErrOIDCLoginInvalid
+		}
+		delete(pending, stateHash)
+		return login, nil
+	}).Maybe()
+}
+
+func newOIDCTestServer(t *testing.T, manager *mockDbManager) (*httptest.Server, *oidctest.Server, *handler) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	idp := oidctest.NewServer("gophermart", "client-secret")
+	t.Cleanup(idp.Close)
+	idp.SetUser(oidctest.User{Subject: "248289761001", Email: "test@example.com", EmailVerified: true, PreferredUsername: "test"})
+
+	r := chi.NewRouter()
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	provider, err := oidc.New(context.Background(), oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "gophermart",
+		ClientSecret: "client-secret",
+		RedirectURL:  srv.URL + "/api/user/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	handler := New(manager, testKeyring(t), logger.Sugar(), WithOIDC(provider))
+	r.Get("/api/user/oidc/login", handler.OIDCLogin)
+	r.Get("/api/user/oidc/callback", handler.OIDCCallback)
+	r.With(handler.BasicAuth).Post("/api/user/oidc/link", handler.LinkOIDC)
+	return srv, idp, handler
+}
+
+// passProvider sends the browser through the stub provider and returns the callback request,
+// with the state cookie the login has set.
+func passProvider(t *testing.T, authURL string, stateCookie *http.Cookie) *http.Request {
+	response, err := noRedirects.Get(authURL)
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusFound, response.StatusCode)
+	callback, err := http.NewRequest(http.MethodGet, response.Header.Get("Location"), nil)
+	require.NoError(t, err)
+	if stateCookie != nil {
+		callback.AddCookie(stateCookie)
+	}
+	return callback
+}
+
+func stateCookie(response *http.Response) *http.Cookie {
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestHandler_OIDCLogin(t *testing.T) {
+	testCases := []struct {
+		name           string
+		dropCookie     bool
+		expect         func(manager *mockDbManager, identity models.Identity)
+		expectedStatus int
+	}{
+		{
+			name: "positive: user is provisioned and signed in",
+			expect: func(manager *mockDbManager, identity models.Identity) {
+				manager.On("LoginWithIdentity", identity, "test").Return("test", nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "positive: second factor is still asked",
+			expect: func(manager *mockDbManager, identity models.Identity) {
+				manager.On("LoginWithIdentity", identity, "test").Return("test", nil)
+				manager.On("TOTPSecret", "test").Return(models.TOTP{Secret: "JBSWY3DPEHPK3PXP", Confirmed: true}, nil)
+				manager.On("CreateLoginChallenge", "test", mock.Anything, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name: "negative: login is taken by a password user",
+			expect: func(manager *mockDbManager, identity models.Identity) {
+				manager.On("LoginWithIdentity", identity, "test").Return("", database.ErrUserAlreadyExists)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "negative: blocked user",
+			expect: func(manager *mockDbManager, identity models.Identity) {
+				manager.On("LoginWithIdentity", identity, "test").Return("", database.ErrUserBlocked)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "negative: callback in another browser",
+			dropCookie:     true,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			srv, idp, _ := newOIDCTestServer(t, manager)
+			if tt.expect != nil {
+				tt.expect(manager, models.Identity{
+					Issuer:            idp.URL,
+					Subject:           "248289761001",
+					Email:             "test@example.com",
+					EmailVerified:     true,
+					PreferredUsername: "test",
+				})
+			}
+			expectOIDCLogins(manager)
+			expectLogin(manager)
+
+			response, err := noRedirects.Get(srv.URL + "/api/user/oidc/login")
+			require.NoError(t, err)
+			response.Body.Close()
+			require.Equal(t, http.StatusFound, response.StatusCode)
+			assert.True(t, strings.HasPrefix(response.Header.Get("Location"), idp.URL+"/authorize?"))
+			cookie := stateCookie(response)
+			require.NotNil(t, cookie)
+			if tt.dropCookie {
+				cookie = nil
+			}
+
+			response, err = noRedirects.Do(passProvider(t, response.Header.Get("Location"), cookie))
+			require.NoError(t, err)
+			defer response.Body.Close()
+			assert.Equal(t, tt.expectedStatus, response.StatusCode)
+			if tt.expectedStatus == http.StatusOK {
+				var tokens models.Tokens
+				require.NoError(t, json.NewDecoder(response.Body).Decode(&tokens))
+				assert.NotEmpty(t, tokens.AccessToken)
+			}
+		})
+	}
+}
+
+func TestHandler_LinkOIDC(t *testing.T) {
+	testCases := []struct {
+		name           string
+		linkErr        error
+		expectedStatus int
+	}{
+		{
+			name:           "positive: identity is linked",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "negative: identity belongs to another user",
+			linkErr:        database.ErrIdentityLinked,
+			expectedStatus: http.StatusConflict,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			srv, idp, handler := newOIDCTestServer(t, manager)
+			manager.On("SessionActive", "session-1").Return(true, nil)
+			manager.On("LinkIdentity", "test", models.Identity{
+				Issuer:            idp.URL,
+				Subject:           "248289761001",
+				Email:             "test@example.com",
+				EmailVerified:     true,
+				PreferredUsername: "test",
+			}).Return(tt.linkErr)
+			expectOIDCLogins(manager)
+
+			token, err := handler.createToken("test", "session-1", []string{models.RoleUser}, time.Now().Add(time.Minute))
+			require.NoError(t, err)
+			request, err := http.NewRequest(http.MethodPost, srv.URL+"/api/user/oidc/link", nil)
+			require.NoError(t, err)
+			request.Header.Set("Authorization", "Bearer "+token)
+			response, err := noRedirects.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			var authorization models.OIDCAuthorization
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&authorization))
+
+			callback, err := noRedirects.Do(passProvider(t, authorization.AuthorizationURL, stateCookie(response)))
+			require.NoError(t, err)
+			callback.Body.Close()
+			assert.Equal(t, tt.expectedStatus, callback.StatusCode)
+			manager.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
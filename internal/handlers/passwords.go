@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/notify"
+	"net/http"
+	"time"
+)
+
+const passwordResetTTL = time.Hour
+
+var defaultPasswordPolicy, _ = auth.NewPasswordPolicy(auth.DefaultPasswordMinLength, nil)
+
+func WithPasswordPolicy(policy *auth.PasswordPolicy) Option {
+	return func(h *handler) {
+		h.passwords = policy
+	}
+}
+
+func WithNotifier(notifier notify.Notifier) Option {
+	return func(h *handler) {
+		h.notifier = notifier
+	}
+}
+
+func (h *handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	var request struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.OldPassword == "" || request.NewPassword == "" {
+		h.log.Errorf("old or new password is empty")
+		writeProblem(w, fmt.Errorf("%w: old_password and new_password are required", ErrMissingField))
+		return
+	}
+	if err := h.passwords.Validate(principal.Login, request.NewPassword); err != nil {
+		h.log.Errorf("new password of user %q is rejected: %s", principal.Login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	// A stolen access token must not turn into an unlimited oracle for the current password.
+	ip := clientIP(r)
+	if locked := h.checkLoginLockout(w, principal.Login, ip); locked {
+		return
+	}
+	if err := h.db.Login(principal.Login, request.OldPassword); err != nil {
+		h.log.Errorf("error while checking old password: %s", err.Error())
+		if errors.Is(err, database.ErrInvalidCredentials) {
+			h.recordFailedLogin(principal.Login, ip)
+		}
+		writeProblem(w, ErrLoginFailed)
+		return
+	}
+	if err := h.db.ChangePassword(principal.Login, request.NewPassword); err != nil {
+		h.log.Errorf("error while changing password: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	clearTokenCookies(w)
+	if err := h.startSession(w, principal.Login); err != nil {
+		h.log.Errorf("error while starting session for user: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.log.Info(fmt.Sprintf("user %q changed password, previous sessions are revoked", principal.Login))
+}
+
+// RequestPasswordReset always answers 202, so it cannot be used to find out which logins exist.
+func (h *handler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if h.notifier == nil {
+		h.log.Errorf("password reset is requested, but no notifier is configured")
+		writeProblem(w, fmt.Errorf("%w: password reset", ErrNotConfigured))
+		return
+	}
+	var request struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Login == "" {
+		h.log.Errorf("login is empty")
+		writeProblem(w, fmt.Errorf("%w: login", ErrMissingField))
+		return
+	}
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		h.log.Errorf("error while generating password reset token: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if err = h.db.CreatePasswordReset(request.Login, tokenHash, time.Now().Add(passwordResetTTL)); err != nil {
+		if errors.Is(err, database.ErrNoSuchUser) {
+			h.log.Infof("password reset is requested for unknown user %q", request.Login)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		h.log.Errorf("error while creating password reset: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if err = h.notifier.SendPasswordReset(r.Context(), request.Login, token); err != nil {
+		h.log.Errorf("error while sending password reset to user %q: %s", request.Login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *handler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" || request.NewPassword == "" {
+		h.log.Errorf("reset token or new password is empty")
+		writeProblem(w, fmt.Errorf("%w: token and new_password are required", ErrMissingField))
+		return
+	}
+	tokenHash := auth.HashToken(request.Token)
+	login, err := h.db.PasswordResetLogin(tokenHash)
+	if err != nil {
+		h.log.Errorf("error while resetting password: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if err = h.passwords.Validate(login, request.NewPassword); err != nil {
+		h.log.Errorf("new password of user %q is rejected: %s", login, err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if _, err = h.db.ResetPassword(tokenHash, request.NewPassword); err != nil {
+		h.log.Errorf("error while resetting password: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.log.Info(fmt.Sprintf("password of user %q is reset", login))
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+type notifierStub struct {
+	tokens map[string]string
+}
+
+func (n *notifierStub) SendPasswordReset(_ context.Context, login string, token string) error {
+	n.tokens[login] = token
+	return nil
+}
+
+func TestHandler_ChangePassword(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	testCases := []struct {
+		name           string
+		body           string
+		loginErr       error
+		lockedFor      time.Duration
+		expectedStatus string
+	}{
+		{
+			name:           "positive: password is changed",
+			body:           `{"old_password": "s3cret-passw0rd", "new_password": "an0ther-passw0rd"}`,
+			expectedStatus: "200 OK",
+		},
+		{
+			name:           "negative: wrong old password",
+			body:           `{"old_password": "wrong-password", "new_password": "an0ther-passw0rd"}`,
+			loginErr:       database.ErrInvalidCredentials,
+			expectedStatus: "401 Unauthorized",
+		},
+		{
+			name:           "negative: locked out",
+			body:           `{"old_password": "wrong-password", "new_password": "an0ther-passw0rd"}`,
+			lockedFor:      time.Minute,
+			expectedStatus: "429 Too Many Requests",
+		},
+		{
+			name:           "negative: weak new password",
+			body:           `{"old_password": "s3cret-passw0rd", "new_password": "qwerty"}`,
+			expectedStatus: "400 Bad Request",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			if tt.expectedStatus != "400 Bad Request" {
+				manager.On("LoginLockout", "test", mock.Anything).Return(tt.lockedFor, nil).Once()
+			}
+			expectLogin(manager)
+			if tt.lockedFor == 0 && tt.expectedStatus != "400 Bad Request" {
+				manager.On("Login", "test", mock.Anything).Return(tt.loginErr)
+			}
+			if tt.loginErr != nil {
+				manager.On("RecordFailedLogin", "test", mock.Anything, mock.Anything, mock.Anything).Return(time.Duration(0), nil).Once()
+			}
+			if tt.expectedStatus == "200 OK" {
+				manager.On("ChangePassword", "test", "an0ther-passw0rd").Return(nil)
+			}
+
+			handler := New(manager, testKeyring(t), &log)
+			r := chi.NewRouter()
+			r.Group(func(r chi.Router) {
+				r.Use(handler.BasicAuth)
+				r.Post("/api/user/password", handler.ChangePassword)
+			})
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			token, err := handler.createToken("test", "session-1", []string{models.RoleUser}, time.Now().Add(time.Minute))
+			assert.NoError(t, err)
+			response, err := resty.New().R().
+				SetHeader("Authorization", "Bearer "+token).SetBody(tt.body).
+				Post(fmt.Sprintf("%s/api/user/password", srv.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.Status())
+			if tt.expectedStatus == "200 OK" {
+				assert.NotEqual(t, "Bearer "+token, response.Header().Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestHandler_PasswordReset(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	t.Run("positive: token is sent and consumed", func(t *testing.T) {
+		notifier := &notifierStub{tokens: make(map[string]string)}
+		manager := newMockDbManager(t)
+		manager.On("CreatePasswordReset", "test", mock.Anything, mock.Anything).Return(nil)
+
+		handler := New(manager, testKeyring(t), &log, WithNotifier(notifier))
+		r := chi.NewRouter()
+		r.Post("/api/user/password/reset", handler.RequestPasswordReset)
+		r.Post("/api/user/password/reset/confirm", handler.ConfirmPasswordReset)
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		response, err := resty.New().R().SetBody(`{"login": "test"}`).
+			Post(fmt.Sprintf("%s/api/user/password/reset", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, "202 Accepted", response.Status())
+		token := notifier.tokens["test"]
+		assert.NotEmpty(t, token)
+		manager.AssertCalled(t, "CreatePasswordReset", "test", auth.HashToken(token), mock.Anything)
+
+		manager.On("PasswordResetLogin", auth.HashToken(token)).Return("test", nil)
+		manager.On("ResetPassword", auth.HashToken(token), "an0ther-passw0rd").Return("test", nil)
+		response, err = resty.New().R().
+			SetBody(fmt.Sprintf(`{"token": %q, "new_password": "an0ther-passw0rd"}`, token)).
+			Post(fmt.Sprintf("%s/api/user/password/reset/confirm", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, "200 OK", response.Status())
+	})
+
+	t.Run("positive: unknown user is not revealed", func(t *testing.T) {
+		notifier := &notifierStub{tokens: make(map[string]string)}
+		manager := newMockDbManager(t)
+		manager.On("CreatePasswordReset", "ghost", mock.Anything, mock.Anything).Return(database.ErrNoSuchUser)
+
+		handler := New(manager, testKeyring(t), &log, WithNotifier(notifier))
+		r := chi.NewRouter()
+		r.Post("/api/user/password/reset", handler.RequestPasswordReset)
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		response, err := resty.New().R().SetBody(`{"login": "ghost"}`).
+			Post(fmt.Sprintf("%s/api/user/password/reset", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, "202 Accepted", response.Status())
+		assert.Empty(t, notifier.tokens)
+	})
+
+	testCases := []struct {
+		name           string
+		body           string
+		resetErr       error
+		expectedStatus string
+	}{
+		{
+			name:           "negative: used or expired token",
+			body:           `{"token": "reset-token", "new_password": "an0ther-passw0rd"}`,
+			resetErr:       database.ErrResetTokenInvalid,
+			expectedStatus: "400 Bad Request",
+		},
+		{
+			name:           "negative: weak new password",
+			body:           `{"token": "reset-token", "new_password": "test"}`,
+			expectedStatus: "400 Bad Request",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			manager.On("PasswordResetLogin", auth.HashToken("reset-token")).Return("test", tt.resetErr)
+
+			handler := New(manager, testKeyring(t), &log)
+			r := chi.NewRouter()
+			r.Post("/api/user/password/reset/confirm", handler.ConfirmPasswordReset)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			response, err := resty.New().R().SetBody(tt.body).
+				Post(fmt.Sprintf("%s/api/user/password/reset/confirm", srv.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.Status())
+			manager.AssertNotCalled(t, "ResetPassword", mock.Anything, mock.Anything)
+		})
+	}
+}
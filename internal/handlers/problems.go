@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"net/http"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:gophermart:problem:"
+)
+
+type problemKind struct {
+	status int
+	code   string
+	title  string
+}
+
+var internalProblem = problemKind{http.StatusInternalServerError, "internal-error", "Internal server error"}
+
+// problemKinds maps sentinel errors to responses. They are matched with errors.Is in order,
+// so an error that wraps several sentinels gets the first one listed.
+var problemKinds = []struct {
+	err  error
+	kind problemKind
+}{
+	{ErrUnauthorized, problemKind{http.StatusUnauthorized, "unauthorized", "Authentication required"}},
+	{ErrTokenIsEmpty, problemKind{http.StatusUnauthorized, "unauthorized", "Authentication required"}},
+	{ErrNoToken, problemKind{http.StatusUnauthorized, "unauthorized", "Authentication required"}},
+	{ErrInvalidToken, problemKind{http.StatusUnauthorized, "invalid-token", "Invalid access token"}},
+	{ErrMalformedToken, problemKind{http.StatusBadRequest, "malformed-token", "Malformed access token"}},
+	{ErrCSRFTokenInvalid, problemKind{http.StatusForbidden, "csrf-token-invalid", "Invalid CSRF token"}},
+	{ErrForbidden, problemKind{http.StatusForbidden, "forbidden", "Forbidden"}},
+	{ErrMalformedBody, problemKind{http.StatusBadRequest, "malformed-body", "Malformed request body"}},
+	{ErrMissingField, problemKind{http.StatusBadRequest, "missing-field", "Missing required field"}},
+	{ErrLoginFailed, problemKind{http.StatusUnauthorized, "invalid-credentials", "Invalid credentials"}},
+	{ErrTooManyAttempts, problemKind{http.StatusTooManyRequests, "too-many-attempts", "Too many attempts"}},
+	{ErrInvalidOrderNumber, problemKind{http.StatusUnprocessableEntity, "invalid-order-number", "Invalid order number"}},
+	{ErrInvalidCode, problemKind{http.StatusBadRequest, "invalid-code", "Invalid code"}},
+	{ErrSelfBlock, problemKind{http.StatusConflict, "self-block", "Cannot block yourself"}},
+	{ErrInvalidAPIKeyRequest, problemKind{http.StatusBadRequest, "invalid-api-key-request", "Invalid API key request"}},
+	{ErrNotConfigured, problemKind{http.StatusNotImplemented, "not-configured", "Not configured"}},
+	{ErrOIDCStateMismatch, problemKind{http.StatusBadRequest, "oidc-state-mismatch", "Single sign-on state mismatch"}},
+	{ErrSingleSignOnFailed, problemKind{http.StatusUnauthorized, "sso-failed", "Single sign-on failed"}},
+	{auth.ErrWeakPassword, problemKind{http.StatusBadRequest, "weak-password", "Weak password"}},
+	{auth.ErrInvalidTOTPCode, problemKind{http.StatusUnauthorized, "invalid-second-factor", "Invalid second factor"}},
+	{database.ErrTOTPCodeReused, problemKind{http.StatusUnauthorized, "invalid-second-factor", "Invalid second factor"}},
+	{database.ErrRecoveryCodeInvalid, problemKind{http.StatusUnauthorized, "invalid-second-factor", "Invalid second factor"}},
+	{database.ErrUserAlreadyExists, problemKind{http.StatusConflict, "login-taken", "Login is taken"}},
+	{database.ErrCreatedDiffUser, problemKind{http.StatusConflict, "order-of-another-user", "Order is uploaded by another user"}},
+	{database.ErrInsufficientBalance, problemKind{http.StatusPaymentRequired, "insufficient-balance", "Insufficient balance"}},
+	{database.ErrInvalidAmount, problemKind{http.StatusUnprocessableEntity, "invalid-amount", "Invalid amount"}},
+	{database.ErrNoSuchUser, problemKind{http.StatusNotFound, "user-not-found", "User not found"}},
+	{database.ErrInvalidCredentials, problemKind{http.StatusUnauthorized, "invalid-credentials", "Invalid credentials"}},
+	{database.ErrUserBlocked, problemKind{http.StatusForbidden, "user-blocked", "User is blocked"}},
+	{database.ErrSessionNotFound, problemKind{http.StatusUnauthorized, "invalid-refresh-token", "Invalid refresh token"}},
+	{database.ErrSessionRevoked, problemKind{http.StatusUnauthorized, "session-revoked", "Session is revoked"}},
+	{database.ErrRefreshTokenReused, problemKind{http.StatusUnauthorized, "refresh-token-reused", "Refresh token is reused"}},
+	{database.ErrResetTokenInvalid, problemKind{http.StatusBadRequest, "invalid-reset-token", "Invalid password reset token"}},
+	{database.ErrTwoFactorEnabled, problemKind{http.StatusConflict, "two-factor-enabled", "Two-factor authentication is enabled"}},
+	{database.ErrTwoFactorNotEnrolled, problemKind{http.StatusBadRequest, "two-factor-not-enrolled", "Two-factor authentication is not enrolled"}},
+	{database.ErrLoginChallengeInvalid, problemKind{http.StatusUnauthorized, "invalid-login-challenge", "Invalid login challenge"}},
+	{database.ErrNoSuchOrder, problemKind{http.StatusNotFound, "order-not-found", "Order not found"}},
+	{database.ErrOrderIsFinal, problemKind{http.StatusConflict, "order-is-final", "Order is in a final status"}},
+	{database.ErrNoSuchAPIKey, problemKind{http.StatusNotFound, "api-key-not-found", "API key not found"}},
+	{database.ErrAPIKeyInvalid, problemKind{http.StatusUnauthorized, "invalid-api-key", "Invalid API key"}},
+	{database.ErrOIDCLoginInvalid, problemKind{http.StatusBadRequest, "invalid-oidc-login", "Invalid single sign-on login"}},
+	{database.ErrIdentityLinked, problemKind{http.StatusConflict, "identity-linked", "Identity is linked to another user"}},
+}
+
+func problemFor(err error) problemKind {
+	for _, p := range problemKinds {
+		if errors.Is(err, p.err) {
+			return p.kind
+		}
+	}
+	return internalProblem
+}
+
+// writeProblem answers with the problem the error maps to; unknown errors are internal ones.
+// Only client errors carry the error text as detail: server errors may include SQL and such.
+func writeProblem(w http.ResponseWriter, err error) {
+	kind := problemFor(err)
+	problem := models.Problem{
+		Type:   problemTypePrefix + kind.code,
+		Title:  kind.title,
+		Status: kind.status,
+		Code:   kind.code,
+	}
+	if kind.status < http.StatusInternalServerError {
+		problem.Detail = err.Error()
+	}
+	result, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(kind.status)
+	w.Write(result)
+}
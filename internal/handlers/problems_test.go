@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteProblem(t *testing.T) {
+	testCases := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+		expectedDetail string
+	}{
+		{
+			name:           "handler sentinel",
+			err:            fmt.Errorf("%w: %q fails the luhn check", ErrInvalidOrderNumber, "123"),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   "invalid-order-number",
+			expectedDetail: `order number is invalid: "123" fails the luhn check`,
+		},
+		{
+			name:           "database sentinel",
+			err:            fmt.Errorf("error while withdrawing: %w", database.ErrInsufficientBalance),
+			expectedStatus: http.StatusPaymentRequired,
+			expectedCode:   "insufficient-balance",
+			expectedDetail: "error while withdrawing: " + database.ErrInsufficientBalance.Error(),
+		},
+		{
+			name:           "first listed sentinel wins",
+			err:            fmt.Errorf("%w: %w", ErrInvalidCode, auth.ErrInvalidTOTPCode),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid-code",
+			expectedDetail: fmt.Sprintf("%s: %s", ErrInvalidCode, auth.ErrInvalidTOTPCode),
+		},
+		{
+			name:           "unknown error hides detail",
+			err:            errors.New("pq: relation \"users\" does not exist"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal-error",
+		},
+		{
+			name:           "raw driver error hides detail",
+			err:            driver.ErrBadConn,
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal-error",
+		},
+		{
+			name:           "wrapped driver error hides detail",
+			err:            fmt.Errorf("error while searching for user %q: %w", "test", sql.ErrConnDone),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal-error",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			writeProblem(recorder, tt.err)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tt.expectedDetail != "", strings.Contains(recorder.Body.String(), `"detail"`))
+			var problem models.Problem
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			assert.Equal(t, models.Problem{
+				Type:   "urn:gophermart:problem:" + tt.expectedCode,
+				Title:  problemFor(tt.err).title,
+				Status: tt.expectedStatus,
+				Detail: tt.expectedDetail,
+				Code:   tt.expectedCode,
+			}, problem)
+		})
+	}
+}
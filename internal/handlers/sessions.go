@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"net/http"
+	"time"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+func (h *handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+		h.log.Errorf("refresh token is empty")
+		writeProblem(w, fmt.Errorf("%w: refresh_token", ErrMissingField))
+		return
+	}
+	refreshToken, refreshTokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		h.log.Errorf("error while generating refresh token: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	session, err := h.db.RotateRefreshToken(auth.HashToken(request.RefreshToken), refreshTokenHash)
+	if err != nil {
+		if errors.Is(err, database.ErrRefreshTokenReused) {
+			h.log.Warnf("refresh token reuse detected, session %q of user %q is revoked", session.ID, session.Login)
+			writeProblem(w, err)
+			return
+		}
+		h.log.Errorf("error while refreshing token: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if err = h.writeTokens(w, session.Login, session.ID, refreshToken); err != nil {
+		h.log.Errorf("error while writing tokens: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+}
+
+func (h *handler) Logout(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	if err := h.db.RevokeSession(principal.Login, principal.SessionID); err != nil {
+		h.log.Errorf("error while revoking session: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	clearTokenCookies(w)
+	h.log.Info(fmt.Sprintf("user %q is logged out", principal.Login))
+}
+
+func (h *handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	if err := h.db.RevokeSessions(principal.Login); err != nil {
+		h.log.Errorf("error while revoking sessions: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	clearTokenCookies(w)
+	h.log.Info(fmt.Sprintf("user %q is logged out of all devices", principal.Login))
+}
+
+func (h *handler) startSession(w http.ResponseWriter, login string) error {
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return err
+	}
+	refreshToken, refreshTokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err = h.db.CreateSession(sessionID, login, refreshTokenHash, time.Now().Add(refreshTokenTTL)); err != nil {
+		return err
+	}
+	return h.writeTokens(w, login, sessionID, refreshToken)
+}
+
+func (h *handler) writeTokens(w http.ResponseWriter, login string, sessionID string, refreshToken string) error {
+	roles, err := h.db.UserRoles(login)
+	if err != nil {
+		return err
+	}
+	expirationTime := time.Now().Add(accessTokenTTL)
+	token, err := h.createToken(login, sessionID, roles, expirationTime)
+	if err != nil {
+		return fmt.Errorf("error while create token for user: %w", err)
+	}
+	result, err := json.Marshal(models.Tokens{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("error while marshalling tokens: %w", err)
+	}
+	csrfToken, err := auth.NewRandomToken()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	setTokenCookies(w, token, csrfToken, expirationTime)
+	w.Write(result)
+	return nil
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandler_RefreshToken(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	testCases := []struct {
+		name           string
+		body           string
+		dbErr          error
+		expectedStatus string
+	}{
+		{
+			name:           "positive: token is rotated",
+			body:           `{"refresh_token": "old-refresh-token"}`,
+			expectedStatus: "200 OK",
+		},
+		{
+			name:           "negative: refresh token reuse",
+			body:           `{"refresh_token": "old-refresh-token"}`,
+			dbErr:          database.ErrRefreshTokenReused,
+			expectedStatus: "401 Unauthorized",
+		},
+		{
+			name:           "negative: revoked session",
+			body:           `{"refresh_token": "old-refresh-token"}`,
+			dbErr:          database.ErrSessionRevoked,
+			expectedStatus: "401 Unauthorized",
+		},
+		{
+			name:           "negative: empty refresh token",
+			body:           `{}`,
+			expectedStatus: "400 Bad Request",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			if tt.expectedStatus != "400 Bad Request" {
+				manager.On("RotateRefreshToken", auth.HashToken("old-refresh-token"), mock.Anything).
+					Return(models.Session{ID: "session-1", Login: "test"}, tt.dbErr)
+			}
+			if tt.expectedStatus == "200 OK" {
+				manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil)
+			}
+
+			keys := testKeyring(t)
+			handler := New(manager, keys, &log)
+			r := chi.NewRouter()
+			r.Post("/api/user/token/refresh", handler.RefreshToken)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			response, err := resty.New().R().
+				SetHeader("Content-Type", "application/json").SetBody(tt.body).
+				Post(fmt.Sprintf("%s/api/user/token/refresh", srv.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, response.Status(), tt.expectedStatus)
+			if tt.expectedStatus != "200 OK" {
+				return
+			}
+
+			var tokens models.Tokens
+			assert.NoError(t, json.Unmarshal(response.Body(), &tokens))
+			assert.NotEqual(t, "old-refresh-token", tokens.RefreshToken)
+			claims := &models.Claims{}
+			_, err = keys.Parse(tokens.AccessToken, claims)
+			assert.NoError(t, err)
+			assert.Equal(t, "session-1", claims.SessionID)
+			assert.Equal(t, "test", claims.Username)
+			assert.Equal(t, []string{models.RoleUser}, claims.Roles)
+		})
+	}
+}
+
+func TestHandler_Logout(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	var sessionID string
+	manager := newMockDbManager(t)
+	manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+	manager.On("LoginLockout", "test", "127.0.0.1").Return(time.Duration(0), nil)
+	manager.On("RecordSuccessfulLogin", "test", "127.0.0.1").Return(nil)
+	manager.On("TOTPSecret", "test").Return(models.TOTP{}, database.ErrTwoFactorNotEnrolled)
+	manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil)
+	manager.On("CreateSession", mock.Anything, "test", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { sessionID = args.String(0) }).Return(nil)
+	manager.On("SessionActive", mock.Anything).Return(true, nil).Once()
+	manager.On("RevokeSession", "test", mock.Anything).Return(nil)
+	manager.On("SessionActive", mock.Anything).Return(false, nil).Once()
+
+	handler := New(manager, testKeyring(t), &log)
+	r := chi.NewRouter()
+	r.Post("/api/user/login", handler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(handler.BasicAuth)
+		r.Post("/api/user/logout", handler.Logout)
+		r.Get("/api/user/balance", handler.GetBalance)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	user, err := resty.New().R().
+		SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
+		Post(fmt.Sprintf("%s/api/user/login", srv.URL))
+	assert.NoError(t, err)
+
+	response, err := resty.New().R().
+		SetHeader("Authorization", user.Header().Get("Authorization")).
+		Post(fmt.Sprintf("%s/api/user/logout", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, response.Status(), "200 OK")
+	manager.AssertCalled(t, "RevokeSession", "test", sessionID)
+
+	response, err = resty.New().R().
+		SetHeader("Authorization", user.Header().Get("Authorization")).
+		Get(fmt.Sprintf("%s/api/user/balance", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, response.Status(), "401 Unauthorized")
+}
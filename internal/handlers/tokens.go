@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	tokenCookie = "token"
+	csrfCookie  = "csrf_token"
+	csrfHeader  = "X-CSRF-Token"
+)
+
+type tokenSource string
+
+const (
+	tokenFromHeader tokenSource = "authorization header"
+	tokenFromCookie tokenSource = "cookie"
+	tokenFromQuery  tokenSource = "query"
+)
+
+// tokenExtractor returns ErrTokenIsEmpty when its source carries no token, so the next one is tried.
+type tokenExtractor struct {
+	source  tokenSource
+	extract func(r *http.Request) (string, error)
+}
+
+func headerExtractor() tokenExtractor {
+	return tokenExtractor{source: tokenFromHeader, extract: func(r *http.Request) (string, error) {
+		tokenHeader := r.Header.Get("Authorization")
+		if tokenHeader == "" {
+			return "", ErrTokenIsEmpty
+		}
+		splitted := strings.Split(tokenHeader, " ")
+		if len(splitted) != 2 {
+			return "", ErrNoToken
+		}
+		return splitted[1], nil
+	}}
+}
+
+func cookieExtractor() tokenExtractor {
+	return tokenExtractor{source: tokenFromCookie, extract: func(r *http.Request) (string, error) {
+		cookie, err := r.Cookie(tokenCookie)
+		if err != nil || cookie.Value == "" {
+			return "", ErrTokenIsEmpty
+		}
+		return cookie.Value, nil
+	}}
+}
+
+func queryExtractor(param string) tokenExtractor {
+	return tokenExtractor{source: tokenFromQuery, extract: func(r *http.Request) (string, error) {
+		token := r.URL.Query().Get(param)
+		if token == "" {
+			return "", ErrTokenIsEmpty
+		}
+		return token, nil
+	}}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(csrfHeader))) == 1
+}
+
+func setTokenCookies(w http.ResponseWriter, token string, csrfToken string, expirationTime time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expirationTime,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		Expires:  expirationTime,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearTokenCookies(w http.ResponseWriter) {
+	for _, name := range []string{tokenCookie, csrfCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == tokenCookie,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandler_BasicAuth_TokenSources(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+	orderNum := "614371538763429"
+
+	testCases := []struct {
+		name           string
+		opts           []Option
+		request        func(r *resty.Request, token string) *resty.Request
+		method         string
+		expectedStatus string
+	}{
+		{
+			name: "positive: cookie on safe method",
+			request: func(r *resty.Request, token string) *resty.Request {
+				return r.SetCookie(&http.Cookie{Name: tokenCookie, Value: token})
+			},
+			method:         http.MethodGet,
+			expectedStatus: "200 OK",
+		},
+		{
+			name: "negative: cookie on unsafe method without csrf token",
+			request: func(r *resty.Request, token string) *resty.Request {
+				return r.SetCookie(&http.Cookie{Name: tokenCookie, Value: token})
+			},
+			method:         http.MethodPost,
+			expectedStatus: "403 Forbidden",
+		},
+		{
+			name: "negative: cookie on unsafe method with mismatching csrf token",
+			request: func(r *resty.Request, token string) *resty.Request {
+				return r.SetCookies([]*http.Cookie{{Name: tokenCookie, Value: token}, {Name: csrfCookie, Value: "csrf"}}).
+					SetHeader(csrfHeader, "other")
+			},
+			method:         http.MethodPost,
+			expectedStatus: "403 Forbidden",
+		},
+		{
+			name: "positive: cookie on unsafe method with csrf token",
+			request: func(r *resty.Request, token string) *resty.Request {
+				return r.SetCookies([]*http.Cookie{{Name: tokenCookie, Value: token}, {Name: csrfCookie, Value: "csrf"}}).
+					SetHeader(csrfHeader, "csrf")
+			},
+			method:         http.MethodPost,
+			expectedStatus: "202 Accepted",
+		},
+		{
+			name: "positive: authorization header needs no csrf token",
+			request: func(r *resty.Request, token string) *resty.Request {
+				return r.SetHeader("Authorization", "Bearer "+token)
+			},
+			method:         http.MethodPost,
+			expectedStatus: "202 Accepted",
+		},
+		{
+			name: "negative: query param is disabled by default",
+			request: func(r *resty.Request, token string) *resty.Request {
+				return r.SetQueryParam("access_token", token)
+			},
+			method:         http.MethodGet,
+			expectedStatus: "401 Unauthorized",
+		},
+		{
+			name: "positive: query param when enabled",
+			opts: []Option{WithQueryToken("access_token")},
+			request: func(r *resty.Request, token string) *resty.Request {
+				return r.SetQueryParam("access_token", token)
+			},
+			method:         http.MethodGet,
+			expectedStatus: "200 OK",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			manager.On("SessionActive", "session-1").Return(true, nil).Maybe()
+			manager.On("GetBalanceInfo", "test").Return([]byte(`{"current":0,"withdrawn":0}`), nil).Maybe()
+			manager.On("LoadOrder", "test", orderNum).Return(nil).Maybe()
+
+			handler := New(manager, testKeyring(t), &log, tt.opts...)
+			r := chi.NewRouter()
+			r.Group(func(r chi.Router) {
+				r.Use(handler.BasicAuth)
+				r.Get("/api/user/balance", handler.GetBalance)
+				r.Post("/api/user/orders", handler.LoadOrder)
+			})
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			token, err := handler.createToken("test", "session-1", []string{models.RoleUser}, time.Now().Add(time.Minute))
+			assert.NoError(t, err)
+
+			request := tt.request(resty.New().R(), token)
+			var response *resty.Response
+			if tt.method == http.MethodGet {
+				response, err = request.Get(fmt.Sprintf("%s/api/user/balance", srv.URL))
+			} else {
+				response, err = request.SetBody(orderNum).Post(fmt.Sprintf("%s/api/user/orders", srv.URL))
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.Status())
+		})
+	}
+}
+
+func TestHandler_Login_Cookies(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	manager := newMockDbManager(t)
+	manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+	manager.On("LoginLockout", "test", "127.0.0.1").Return(time.Duration(0), nil)
+	manager.On("RecordSuccessfulLogin", "test", "127.0.0.1").Return(nil)
+	manager.On("TOTPSecret", "test").Return(models.TOTP{}, database.ErrTwoFactorNotEnrolled)
+	manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil)
+	manager.On("CreateSession", mock.Anything, "test", mock.Anything, mock.Anything).Return(nil)
+
+	handler := New(manager, testKeyring(t), logger.Sugar())
+	r := chi.NewRouter()
+	r.Post("/api/user/login", handler.Login)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	response, err := resty.New().R().
+		SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
+		Post(fmt.Sprintf("%s/api/user/login", srv.URL))
+	assert.NoError(t, err)
+
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range response.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	if assert.Contains(t, cookies, tokenCookie) {
+		assert.True(t, cookies[tokenCookie].HttpOnly)
+		assert.True(t, cookies[tokenCookie].Secure)
+		assert.Equal(t, http.SameSiteLaxMode, cookies[tokenCookie].SameSite)
+	}
+	if assert.Contains(t, cookies, csrfCookie) {
+		assert.False(t, cookies[csrfCookie].HttpOnly, "csrf cookie must be readable by scripts")
+		assert.NotEmpty(t, cookies[csrfCookie].Value)
+	}
+}
+
+func TestHandler_RequiresPrincipal(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+
+	handler := New(newMockDbManager(t), testKeyring(t), logger.Sugar())
+	r := chi.NewRouter()
+	r.Post("/api/user/balance/withdraw", handler.Withdraw)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	response, err := resty.New().R().
+		SetBody(`{"order": "2377225624", "sum": 20}`).
+		Post(fmt.Sprintf("%s/api/user/balance/withdraw", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "401 Unauthorized", response.Status())
+}
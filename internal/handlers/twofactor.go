@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"net/http"
+	"time"
+)
+
+const (
+	totpIssuer             = "Gophermart"
+	recoveryCodeCount      = 10
+	loginChallengeTTL      = 5 * time.Minute
+	loginChallengeAttempts = 5
+)
+
+func (h *handler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		h.log.Errorf("error while generating totp secret: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if err = h.db.EnrollTOTP(principal.Login, secret); err != nil {
+		h.log.Errorf("error while enrolling totp: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	result, err := json.Marshal(models.TOTPEnrollment{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(totpIssuer, principal.Login, secret),
+	})
+	if err != nil {
+		h.log.Errorf("error while marshalling totp enrollment: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Write(result)
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves the authenticator app
+// produces valid codes, and returns the recovery codes: this is the only time they are shown.
+func (h *handler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	code, err := h.parseCode(r)
+	if err != nil {
+		writeProblem(w, err)
+		return
+	}
+	totp, err := h.db.TOTPSecret(principal.Login)
+	if err != nil {
+		h.log.Errorf("error while confirming totp: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if totp.Confirmed {
+		writeProblem(w, database.ErrTwoFactorEnabled)
+		return
+	}
+	step, err := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if err != nil {
+		h.log.Errorf("error while confirming totp of user %q: %s", principal.Login, err.Error())
+		writeProblem(w, fmt.Errorf("%w: %w", ErrInvalidCode, err))
+		return
+	}
+	codes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		h.log.Errorf("error while generating recovery codes: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	codeHashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		codeHashes = append(codeHashes, auth.HashRecoveryCode(c))
+	}
+	if err = h.db.ConfirmTOTP(principal.Login, step, codeHashes); err != nil {
+		if errors.Is(err, database.ErrTwoFactorNotEnrolled) {
+			// Someone else confirmed the enrollment in the meantime.
+			h.log.Errorf("error while confirming totp: %s", err.Error())
+			writeProblem(w, database.ErrTwoFactorEnabled)
+			return
+		}
+		h.log.Errorf("error while confirming totp: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	result, err := json.Marshal(models.RecoveryCodes{RecoveryCodes: codes})
+	if err != nil {
+		h.log.Errorf("error while marshalling recovery codes: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	w.Write(result)
+	h.log.Info(fmt.Sprintf("user %q enabled two-factor authentication", principal.Login))
+}
+
+func (h *handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.principal(r)
+	if !ok {
+		writeProblem(w, ErrUnauthorized)
+		return
+	}
+	code, err := h.parseCode(r)
+	if err != nil {
+		writeProblem(w, err)
+		return
+	}
+	// Without the lockout a stolen session could guess its way to switching two-factor off.
+	ip := clientIP(r)
+	if locked := h.checkLoginLockout(w, principal.Login, ip); locked {
+		return
+	}
+	if err = h.verifySecondFactor(principal.Login, code); err != nil {
+		h.log.Errorf("error while disabling totp of user %q: %s", principal.Login, err.Error())
+		if isInvalidSecondFactor(err) {
+			h.recordFailedLogin(principal.Login, ip)
+		}
+		writeProblem(w, err)
+		return
+	}
+	if err = h.db.DisableTOTP(principal.Login); err != nil {
+		h.log.Errorf("error while disabling totp: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.log.Info(fmt.Sprintf("user %q disabled two-factor authentication", principal.Login))
+}
+
+func (h *handler) startLoginChallenge(w http.ResponseWriter, login string) error {
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err = h.db.CreateLoginChallenge(login, tokenHash, time.Now().Add(loginChallengeTTL)); err != nil {
+		return err
+	}
+	result, err := json.Marshal(models.LoginChallenge{
+		MFAToken:  token,
+		ExpiresIn: int64(loginChallengeTTL.Seconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("error while marshalling login challenge: %w", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(result)
+	return nil
+}
+
+// completeLoginChallenge is the second login step. Wrong codes count as failed logins,
+// so the lockout policy also covers guessing the six digits.
+func (h *handler) completeLoginChallenge(w http.ResponseWriter, r *http.Request, token string, code string) {
+	if code == "" {
+		h.log.Errorf("second factor code is empty")
+		writeProblem(w, fmt.Errorf("%w: code", ErrMissingField))
+		return
+	}
+	tokenHash := auth.HashToken(token)
+	login, err := h.db.UseLoginChallenge(tokenHash, loginChallengeAttempts)
+	if err != nil {
+		h.log.Errorf("error while completing login: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	ip := clientIP(r)
+	if locked := h.checkLoginLockout(w, login, ip); locked {
+		return
+	}
+	if err = h.verifySecondFactor(login, code); err != nil {
+		if isInvalidSecondFactor(err) {
+			h.log.Errorf("error while completing login of user %q: %s", login, err.Error())
+			h.recordFailedLogin(login, ip)
+			writeProblem(w, err)
+			return
+		}
+		h.log.Errorf("error while completing login: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	if err = h.db.CompleteLoginChallenge(tokenHash); err != nil {
+		h.log.Errorf("error while completing login: %s", err.Error())
+		writeProblem(w, err)
+		return
+	}
+	h.finishLogin(w, login, ip)
+}
+
+// verifySecondFactor accepts either a current totp code or an unused recovery code.
+func (h *handler) verifySecondFactor(login string, code string) error {
+	if !isTOTPCode(code) {
+		return h.db.UseRecoveryCode(login, auth.HashRecoveryCode(code))
+	}
+	totp, err := h.db.TOTPSecret(login)
+	if err != nil {
+		return err
+	}
+	if !totp.Confirmed {
+		return database.ErrTwoFactorNotEnrolled
+	}
+	step, err := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if err != nil {
+		return err
+	}
+	return h.db.UseTOTPStep(login, step)
+}
+
+func isInvalidSecondFactor(err error) bool {
+	return errors.Is(err, auth.ErrInvalidTOTPCode) ||
+		errors.Is(err, database.ErrTOTPCodeReused) ||
+		errors.Is(err, database.ErrRecoveryCodeInvalid)
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *handler) parseCode(r *http.Request) (string, error) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		h.log.Errorf("code is empty")
+		return "", fmt.Errorf("%w: code", ErrMissingField)
+	}
+	return request.Code, nil
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHandler_Login_TwoFactor(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	t.Run("positive: password step asks for the second factor", func(t *testing.T) {
+		manager := newMockDbManager(t)
+		manager.On("LoginLockout", "test", "127.0.0.1").Return(time.Duration(0), nil)
+		manager.On("Login", "test", "s3cret-passw0rd").Return(nil)
+		manager.On("TOTPSecret", "test").Return(models.TOTP{Secret: testTOTPSecret, Confirmed: true}, nil)
+		manager.On("CreateLoginChallenge", "test", mock.Anything, mock.Anything).Return(nil)
+
+		handler := New(manager, testKeyring(t), &log)
+		r := chi.NewRouter()
+		r.Post("/api/user/login", handler.Login)
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		response, err := resty.New().R().
+			SetBody(`{"login": "test", "password": "s3cret-passw0rd"}`).
+			Post(fmt.Sprintf("%s/api/user/login", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, "202 Accepted", response.Status())
+		assert.Empty(t, response.Header().Get("Authorization"))
+		var challenge models.LoginChallenge
+		require.NoError(t, json.Unmarshal(response.Body(), &challenge))
+		assert.NotEmpty(t, challenge.MFAToken)
+		manager.AssertCalled(t, "CreateLoginChallenge", "test", auth.HashToken(challenge.MFAToken), mock.Anything)
+	})
+
+	code, err := auth.TOTPCode(testTOTPSecret, time.Now())
+	require.NoError(t, err)
+	testCases := []struct {
+		name           string
+		code           string
+		expect         func(manager *mockDbManager)
+		expectedStatus string
+	}{
+		{
+			name: "positive: totp code",
+			code: code,
+			expect: func(manager *mockDbManager) {
+				manager.On("TOTPSecret", "test").Return(models.TOTP{Secret: testTOTPSecret, Confirmed: true}, nil)
+				manager.On("UseTOTPStep", "test", mock.Anything).Return(nil)
+				manager.On("CompleteLoginChallenge", auth.HashToken("mfa-token")).Return(nil)
+				manager.On("RecordSuccessfulLogin", "test", "127.0.0.1").Return(nil)
+				manager.On("CreateSession", mock.Anything, "test", mock.Anything, mock.Anything).Return(nil)
+				manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil)
+			},
+			expectedStatus: "200 OK",
+		},
+		{
+			name: "positive: recovery code",
+			code: "abcdefgh-ijklmnop",
+			expect: func(manager *mockDbManager) {
+				manager.On("UseRecoveryCode", "test", auth.HashRecoveryCode("abcdefgh-ijklmnop")).Return(nil)
+				manager.On("CompleteLoginChallenge", auth.HashToken("mfa-token")).Return(nil)
+				manager.On("RecordSuccessfulLogin", "test", "127.0.0.1").Return(nil)
+				manager.On("CreateSession", mock.Anything, "test", mock.Anything, mock.Anything).Return(nil)
+				manager.On("UserRoles", "test").Return([]string{models.RoleUser}, nil)
+			},
+			expectedStatus: "200 OK",
+		},
+		{
+			name: "negative: replayed totp code",
+			code: code,
+			expect: func(manager *mockDbManager) {
+				manager.On("TOTPSecret", "test").Return(models.TOTP{Secret: testTOTPSecret, Confirmed: true}, nil)
+				manager.On("UseTOTPStep", "test", mock.Anything).Return(database.ErrTOTPCodeReused)
+				manager.On("RecordFailedLogin", "test", "127.0.0.1", defaultLoginLockout, defaultIPLockout).Return(time.Duration(0), nil)
+			},
+			expectedStatus: "401 Unauthorized",
+		},
+		{
+			name: "negative: wrong code",
+			code: "000000",
+			expect: func(manager *mockDbManager) {
+				manager.On("TOTPSecret", "test").Return(models.TOTP{Secret: testTOTPSecret, Confirmed: true}, nil)
+				manager.On("RecordFailedLogin", "test", "127.0.0.1", defaultLoginLockout, defaultIPLockout).Return(time.Duration(0), nil)
+			},
+			expectedStatus: "401 Unauthorized",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			manager.On("UseLoginChallenge", auth.HashToken("mfa-token"), loginChallengeAttempts).Return("test", nil)
+			manager.On("LoginLockout", "test", "127.0.0.1").Return(time.Duration(0), nil)
+			tt.expect(manager)
+
+			handler := New(manager, testKeyring(t), &log)
+			r := chi.NewRouter()
+			r.Post("/api/user/login", handler.Login)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			response, err := resty.New().R().
+				SetBody(fmt.Sprintf(`{"mfa_token": "mfa-token", "code": %q}`, tt.code)).
+				Post(fmt.Sprintf("%s/api/user/login", srv.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.Status())
+			assert.Equal(t, tt.expectedStatus == "200 OK", response.Header().Get("Authorization") != "")
+		})
+	}
+
+	t.Run("negative: exhausted challenge", func(t *testing.T) {
+		manager := newMockDbManager(t)
+		manager.On("UseLoginChallenge", auth.HashToken("mfa-token"), loginChallengeAttempts).Return("", database.ErrLoginChallengeInvalid)
+
+		handler := New(manager, testKeyring(t), &log)
+		r := chi.NewRouter()
+		r.Post("/api/user/login", handler.Login)
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		response, err := resty.New().R().
+			SetBody(fmt.Sprintf(`{"mfa_token": "mfa-token", "code": %q}`, code)).
+			Post(fmt.Sprintf("%s/api/user/login", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, "401 Unauthorized", response.Status())
+	})
+}
+
+func TestHandler_EnrollTwoFactor(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	var (
+		secret     string
+		codeHashes []string
+	)
+	manager := newMockDbManager(t)
+	manager.On("SessionActive", "session-1").Return(true, nil)
+	manager.On("EnrollTOTP", "test", mock.Anything).Run(func(args mock.Arguments) { secret = args.String(1) }).Return(nil)
+	manager.On("TOTPSecret", "test").Return(func(string) models.TOTP { return models.TOTP{Secret: secret} }, nil)
+	manager.On("ConfirmTOTP", "test", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { codeHashes = args.Get(2).([]string) }).Return(nil)
+
+	handler := New(manager, testKeyring(t), &log)
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(handler.BasicAuth)
+		r.Post("/api/user/2fa/enroll", handler.EnrollTwoFactor)
+		r.Post("/api/user/2fa/confirm", handler.ConfirmTwoFactor)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	token, err := handler.createToken("test", "session-1", []string{models.RoleUser}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	response, err := resty.New().R().SetHeader("Authorization", "Bearer "+token).
+		Post(fmt.Sprintf("%s/api/user/2fa/enroll", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "200 OK", response.Status())
+	var enrollment models.TOTPEnrollment
+	require.NoError(t, json.Unmarshal(response.Body(), &enrollment))
+	assert.Equal(t, secret, enrollment.Secret)
+	assert.Equal(t, auth.TOTPURI(totpIssuer, "test", secret), enrollment.OtpauthURI)
+
+	response, err = resty.New().R().SetHeader("Authorization", "Bearer "+token).
+		SetBody(`{"code": "000000"}`).
+		Post(fmt.Sprintf("%s/api/user/2fa/confirm", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "400 Bad Request", response.Status())
+
+	code, err := auth.TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	response, err = resty.New().R().SetHeader("Authorization", "Bearer "+token).
+		SetBody(fmt.Sprintf(`{"code": %q}`, code)).
+		Post(fmt.Sprintf("%s/api/user/2fa/confirm", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "200 OK", response.Status())
+	var recovery models.RecoveryCodes
+	require.NoError(t, json.Unmarshal(response.Body(), &recovery))
+	assert.Len(t, recovery.RecoveryCodes, recoveryCodeCount)
+	require.Len(t, codeHashes, recoveryCodeCount)
+	assert.Equal(t, auth.HashRecoveryCode(recovery.RecoveryCodes[0]), codeHashes[0])
+}
+
+func TestHandler_DisableTwoFactor(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	testCases := []struct {
+		name           string
+		code           string
+		lockedFor      time.Duration
+		expect         func(manager *mockDbManager)
+		expectedStatus string
+	}{
+		{
+			name: "positive: recovery code",
+			code: "abcdefgh-ijklmnop",
+			expect: func(manager *mockDbManager) {
+				manager.On("UseRecoveryCode", "test", auth.HashRecoveryCode("abcdefgh-ijklmnop")).Return(nil)
+				manager.On("DisableTOTP", "test").Return(nil)
+			},
+			expectedStatus: "200 OK",
+		},
+		{
+			name: "negative: wrong code is counted as a failed login",
+			code: "000000",
+			expect: func(manager *mockDbManager) {
+				manager.On("TOTPSecret", "test").Return(models.TOTP{Secret: testTOTPSecret, Confirmed: true}, nil)
+				manager.On("RecordFailedLogin", "test", "127.0.0.1", defaultLoginLockout, defaultIPLockout).Return(time.Duration(0), nil)
+			},
+			expectedStatus: "401 Unauthorized",
+		},
+		{
+			name:           "negative: locked out",
+			code:           "000000",
+			lockedFor:      time.Minute,
+			expect:         func(manager *mockDbManager) {},
+			expectedStatus: "429 Too Many Requests",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			manager.On("SessionActive", "session-1").Return(true, nil)
+			manager.On("LoginLockout", "test", "127.0.0.1").Return(tt.lockedFor, nil)
+			tt.expect(manager)
+
+			handler := New(manager, testKeyring(t), &log)
+			r := chi.NewRouter()
+			r.Group(func(r chi.Router) {
+				r.Use(handler.BasicAuth)
+				r.Post("/api/user/2fa/disable", handler.DisableTwoFactor)
+			})
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+			token, err := handler.createToken("test", "session-1", []string{models.RoleUser}, time.Now().Add(time.Minute))
+			require.NoError(t, err)
+
+			response, err := resty.New().R().SetHeader("Authorization", "Bearer "+token).
+				SetBody(fmt.Sprintf(`{"code": %q}`, tt.code)).
+				Post(fmt.Sprintf("%s/api/user/2fa/disable", srv.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, response.Status())
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandler_Withdraw_Concurrent(t *testing.T) {
+	databaseURI := os.Getenv("DATABASE_URI")
+	if databaseURI == "" {
+		t.Skip("DATABASE_URI is not set")
+	}
+	const (
+		requests = 300
+		accrual  = models.Money(100000)
+		sum      = models.Money(1000)
+	)
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	ctx := context.Background()
+	db, err := sql.Open("pgx", databaseURI)
+	require.NoError(t, err)
+	defer db.Close()
+	manager, err := database.New(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, manager.MigrateUp(ctx))
+
+	seed := time.Now().UnixMilli()
+	login := fmt.Sprintf("withdraw-race-%d", seed)
+	order := luhnNumber(seed * 1000)
+	require.NoError(t, manager.Register(login, "test-password"))
+	require.NoError(t, manager.LoadOrder(login, order))
+	require.NoError(t, manager.UpdateOrderInfo(&models.OrderInfo{
+		Order:   &order,
+		Status:  models.OrderStatusProcessed,
+		Accrual: accrual,
+	}, 0))
+
+	handler := New(manager, testKeyring(t), log)
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(handler.BasicAuth)
+		r.Post("/api/user/balance/withdraw", handler.Withdraw)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	sessionID := fmt.Sprintf("session-%d", seed)
+	require.NoError(t, manager.CreateSession(sessionID, login, fmt.Sprintf("refresh-%d", seed), time.Now().Add(time.Hour)))
+	token, err := handler.createToken(login, sessionID, []string{models.RoleUser}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		statuses = make(map[int]int)
+	)
+	for i := 1; i <= requests; i++ {
+		wg.Add(1)
+		go func(withdrawOrder string) {
+			defer wg.Done()
+			response, err := resty.New().R().
+				SetHeader("Authorization", fmt.Sprintf("Bearer %s", token)).
+				SetBody(fmt.Sprintf(`{"order": %q, "sum": %s}`, withdrawOrder, sum)).
+				Post(fmt.Sprintf("%s/api/user/balance/withdraw", srv.URL))
+			assert.NoError(t, err)
+			mu.Lock()
+			statuses[response.StatusCode()]++
+			mu.Unlock()
+		}(luhnNumber(seed*1000 + int64(i)))
+	}
+	wg.Wait()
+
+	assert.Equal(t, int(accrual/sum), statuses[http.StatusOK])
+	assert.Equal(t, requests-int(accrual/sum), statuses[http.StatusPaymentRequired])
+
+	balance, err := manager.GetBalanceInfo(login)
+	require.NoError(t, err)
+	assert.Equal(t, `{"current":0,"withdrawn":1000}`, string(balance))
+}
+
+func luhnNumber(base int64) string {
+	digits := strconv.FormatInt(base, 10)
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return digits + strconv.Itoa((10-sum%10)%10)
+}
@@ -0,0 +1,25 @@
+package loyalty
+
+import (
+	"math/rand"
+	"time"
+)
+
+type backoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.max
+	if attempt < 1 {
+		attempt = 1
+	}
+	if shift := attempt - 1; shift < 32 {
+		if exp := b.base << shift; exp > 0 && exp < b.max {
+			d = exp
+		}
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
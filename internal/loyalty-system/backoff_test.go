@@ -0,0 +1,20 @@
+package loyalty
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	b := backoff{base: time.Second, max: time.Minute}
+	for attempt := 1; attempt <= 100; attempt++ {
+		expected := time.Minute
+		if attempt <= 6 {
+			expected = time.Second << (attempt - 1)
+		}
+		d := b.delay(attempt)
+		assert.GreaterOrEqual(t, d, expected/2)
+		assert.LessOrEqual(t, d, expected)
+	}
+}
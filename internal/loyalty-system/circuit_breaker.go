@@ -0,0 +1,122 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("accrual system circuit breaker is open")
+
+type CircuitBreaker struct {
+	client    AccrualClient
+	threshold int
+	cooldown  time.Duration
+	log       *zap.SugaredLogger
+
+	mu       sync.Mutex
+	state    models.CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(client AccrualClient, threshold int, cooldown time.Duration, logger *zap.SugaredLogger) *CircuitBreaker {
+	return &CircuitBreaker{
+		client:    client,
+		threshold: threshold,
+		cooldown:  cooldown,
+		log:       logger,
+		state:     models.CircuitClosed,
+	}
+}
+
+func (cb *CircuitBreaker) GetOrderInfo(ctx context.Context, orderID string) (*models.AccrualInfo, error) {
+	if !cb.allow() {
+		return nil, ErrCircuitOpen
+	}
+	info, err := cb.client.GetOrderInfo(ctx, orderID)
+	cb.record(err)
+	return info, err
+}
+
+func (cb *CircuitBreaker) Throttle() models.ThrottleState {
+	return cb.client.Throttle()
+}
+
+func (cb *CircuitBreaker) State() models.CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+func (cb *CircuitBreaker) RetryIn() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == models.CircuitClosed {
+		return 0
+	}
+	if retryIn := time.Until(cb.openedAt.Add(cb.cooldown)); retryIn > 0 {
+		return retryIn
+	}
+	return 0
+}
+
+func (cb *CircuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case models.CircuitOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.setState(models.CircuitHalfOpen)
+		cb.probing = true
+		return true
+	case models.CircuitHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (cb *CircuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+	if !isAccrualFailure(err) {
+		cb.failures = 0
+		if cb.state != models.CircuitClosed {
+			cb.setState(models.CircuitClosed)
+		}
+		return
+	}
+	cb.failures++
+	if cb.state == models.CircuitHalfOpen || cb.failures >= cb.threshold {
+		cb.openedAt = time.Now()
+		cb.setState(models.CircuitOpen)
+	}
+}
+
+func (cb *CircuitBreaker) setState(state models.CircuitState) {
+	if cb.state == state {
+		return
+	}
+	cb.log.Infof("accrual circuit breaker changed state: %s -> %s", cb.state, state)
+	cb.state = state
+}
+
+func isAccrualFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, ErrOrderNotRegistered) &&
+		!errors.Is(err, ErrTooManyRequests) &&
+		!errors.As(err, &ErrThrottled{}) &&
+		!errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,75 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+type stubClient struct {
+	err error
+}
+
+func (c *stubClient) GetOrderInfo(_ context.Context, orderID string) (*models.AccrualInfo, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &models.AccrualInfo{Order: orderID, Status: models.AccrualStatusProcessed}, nil
+}
+
+func (c *stubClient) Throttle() models.ThrottleState {
+	return models.ThrottleState{}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Sync()
+	ctx := context.Background()
+
+	t.Run("opens after threshold and recovers through half-open", func(t *testing.T) {
+		client := &stubClient{err: errors.New("connection refused")}
+		cb := NewCircuitBreaker(client, 2, 50*time.Millisecond, logger.Sugar())
+
+		_, err := cb.GetOrderInfo(ctx, "1")
+		assert.Error(t, err)
+		assert.Equal(t, models.CircuitClosed, cb.State())
+		_, err = cb.GetOrderInfo(ctx, "1")
+		assert.Error(t, err)
+		assert.Equal(t, models.CircuitOpen, cb.State())
+		assert.Greater(t, cb.RetryIn(), time.Duration(0))
+
+		_, err = cb.GetOrderInfo(ctx, "1")
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, time.Duration(0), cb.RetryIn())
+		_, err = cb.GetOrderInfo(ctx, "1")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+		assert.Equal(t, models.CircuitOpen, cb.State())
+
+		time.Sleep(60 * time.Millisecond)
+		client.err = nil
+		_, err = cb.GetOrderInfo(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, models.CircuitClosed, cb.State())
+	})
+
+	t.Run("throttling and unregistered orders are not failures", func(t *testing.T) {
+		client := &stubClient{err: ErrTooManyRequests}
+		cb := NewCircuitBreaker(client, 1, time.Minute, logger.Sugar())
+		_, _ = cb.GetOrderInfo(ctx, "1")
+		client.err = ErrOrderNotRegistered
+		_, _ = cb.GetOrderInfo(ctx, "1")
+		client.err = ErrThrottled{Until: time.Now().Add(time.Minute)}
+		_, _ = cb.GetOrderInfo(ctx, "1")
+		assert.Equal(t, models.CircuitClosed, cb.State())
+	})
+}
@@ -0,0 +1,162 @@
+package loyalty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"go.uber.org/zap"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRetryAfter = time.Minute
+
+var (
+	ErrTooManyRequests    = errors.New("too many requests to accrual system")
+	ErrOrderNotRegistered = errors.New("order is not registered in accrual system")
+	rateLimitPattern      = regexp.MustCompile(`No more than (\d+) requests per minute`)
+)
+
+// ErrThrottled is returned instead of waiting when the accrual system may not be
+// called again before the request deadline.
+type ErrThrottled struct {
+	Until time.Time
+}
+
+func (e ErrThrottled) Error() string {
+	return fmt.Sprintf("accrual system is throttled until %s", e.Until.Format(time.RFC3339))
+}
+
+type HTTPClient struct {
+	addr   string
+	client *resty.Client
+	log    *zap.SugaredLogger
+
+	mu                sync.Mutex
+	pausedUntil       time.Time
+	requestsPerMinute int
+	nextRequestAt     time.Time
+}
+
+func NewHTTPClient(addr string, logger *zap.SugaredLogger) *HTTPClient {
+	return &HTTPClient{
+		addr:   addr,
+		client: resty.New(),
+		log:    logger,
+	}
+}
+
+func (c *HTTPClient) GetOrderInfo(ctx context.Context, orderID string) (*models.AccrualInfo, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+	orderFromSystem, err := c.client.R().SetContext(ctx).Get(fmt.Sprintf("%s/api/orders/%s", c.addr, orderID))
+	if err != nil {
+		return nil, fmt.Errorf("error while requesting for order %q: %w", orderID, err)
+	}
+	switch orderFromSystem.StatusCode() {
+	case http.StatusOK:
+		var info models.AccrualInfo
+		if err = json.Unmarshal(orderFromSystem.Body(), &info); err != nil {
+			return nil, fmt.Errorf("error while unmarshalling order body: %w", err)
+		}
+		return &info, nil
+	case http.StatusNoContent:
+		return nil, ErrOrderNotRegistered
+	case http.StatusTooManyRequests:
+		c.throttle(orderFromSystem.Header().Get("Retry-After"), orderFromSystem.String())
+		return nil, ErrTooManyRequests
+	default:
+		return nil, fmt.Errorf("unexpected status code %d for order %q", orderFromSystem.StatusCode(), orderID)
+	}
+}
+
+func (c *HTTPClient) Throttle() models.ThrottleState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := models.ThrottleState{RequestsPerMinute: c.requestsPerMinute}
+	if time.Now().Before(c.pausedUntil) {
+		pausedUntil := c.pausedUntil
+		state.Throttled = true
+		state.PausedUntil = &pausedUntil
+	}
+	return state
+}
+
+func (c *HTTPClient) wait(ctx context.Context) error {
+	c.mu.Lock()
+	requestAt := time.Now()
+	if requestAt.Before(c.pausedUntil) {
+		requestAt = c.pausedUntil
+	}
+	if requestAt.Before(c.nextRequestAt) {
+		requestAt = c.nextRequestAt
+	}
+	if deadline, ok := ctx.Deadline(); ok && !requestAt.Before(deadline) {
+		c.mu.Unlock()
+		return ErrThrottled{Until: requestAt}
+	}
+	var slotEnd time.Time
+	if c.requestsPerMinute > 0 {
+		slotEnd = requestAt.Add(time.Minute / time.Duration(c.requestsPerMinute))
+		c.nextRequestAt = slotEnd
+	}
+	c.mu.Unlock()
+
+	delay := time.Until(requestAt)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		c.release(requestAt, slotEnd)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// release gives back an unused request slot unless a later one was already reserved after it.
+func (c *HTTPClient) release(requestAt, slotEnd time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !slotEnd.IsZero() && c.nextRequestAt.Equal(slotEnd) {
+		c.nextRequestAt = requestAt
+	}
+}
+
+func (c *HTTPClient) throttle(retryAfterHeader string, body string) {
+	retryAfter := parseRetryAfter(retryAfterHeader)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pausedUntil := time.Now().Add(retryAfter); pausedUntil.After(c.pausedUntil) {
+		c.pausedUntil = pausedUntil
+	}
+	if matches := rateLimitPattern.FindStringSubmatch(body); matches != nil {
+		if limit, err := strconv.Atoi(matches[1]); err == nil && limit > 0 {
+			c.requestsPerMinute = limit
+		}
+	}
+	c.log.Infof("accrual system is throttled until %s, limit is %d requests per minute", c.pausedUntil.Format(time.RFC3339), c.requestsPerMinute)
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
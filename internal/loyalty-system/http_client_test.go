@@ -0,0 +1,134 @@
+package loyalty
+
+import (
+	"context"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient_GetOrderInfo(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Sync()
+
+	t.Run("positive", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/orders/100500", r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"100500","status":"PROCESSED","accrual":500}`))
+		}))
+		defer srv.Close()
+
+		client := NewHTTPClient(srv.URL, logger.Sugar())
+		info, err := client.GetOrderInfo(context.Background(), "100500")
+		assert.NoError(t, err)
+		assert.Equal(t, "100500", info.Order)
+		assert.Equal(t, models.AccrualStatusProcessed, info.Status)
+		assert.Equal(t, models.Money(50000), info.Accrual)
+		assert.False(t, client.Throttle().Throttled)
+	})
+
+	t.Run("positive: accrual is rounded to kopecks", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"100500","status":"PROCESSED","accrual":10.005}`))
+		}))
+		defer srv.Close()
+
+		client := NewHTTPClient(srv.URL, logger.Sugar())
+		info, err := client.GetOrderInfo(context.Background(), "100500")
+		assert.NoError(t, err)
+		assert.Equal(t, models.Money(1001), info.Accrual)
+	})
+
+	t.Run("negative: too many requests", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("No more than 30 requests per minute allowed"))
+		}))
+		defer srv.Close()
+
+		client := NewHTTPClient(srv.URL, logger.Sugar())
+		_, err := client.GetOrderInfo(context.Background(), "100500")
+		assert.ErrorIs(t, err, ErrTooManyRequests)
+
+		throttle := client.Throttle()
+		assert.True(t, throttle.Throttled)
+		assert.Equal(t, 30, throttle.RequestsPerMinute)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), *throttle.PausedUntil, 5*time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = client.GetOrderInfo(ctx, "100500")
+		assert.ErrorAs(t, err, &ErrThrottled{})
+	})
+
+	t.Run("negative: order is not registered", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		client := NewHTTPClient(srv.URL, logger.Sugar())
+		_, err := client.GetOrderInfo(context.Background(), "100500")
+		assert.ErrorIs(t, err, ErrOrderNotRegistered)
+	})
+
+	t.Run("negative: unexpected status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		client := NewHTTPClient(srv.URL, logger.Sugar())
+		_, err := client.GetOrderInfo(context.Background(), "100500")
+		assert.EqualError(t, err, `unexpected status code 500 for order "100500"`)
+	})
+}
+
+func TestHTTPClient_Wait(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Sync()
+
+	t.Run("slot beyond the deadline is not reserved", func(t *testing.T) {
+		client := NewHTTPClient("http://localhost", logger.Sugar())
+		client.requestsPerMinute = 1
+		nextRequestAt := time.Now().Add(time.Minute)
+		client.nextRequestAt = nextRequestAt
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, ErrThrottled{Until: nextRequestAt}, client.wait(ctx))
+		assert.Equal(t, nextRequestAt, client.nextRequestAt)
+	})
+
+	t.Run("aborted wait releases its slot", func(t *testing.T) {
+		client := NewHTTPClient("http://localhost", logger.Sugar())
+		client.requestsPerMinute = 60
+		nextRequestAt := time.Now().Add(time.Second)
+		client.nextRequestAt = nextRequestAt
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		assert.ErrorIs(t, client.wait(ctx), context.Canceled)
+		assert.Equal(t, nextRequestAt, client.nextRequestAt)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 60*time.Second, parseRetryAfter("60"))
+	assert.Equal(t, defaultRetryAfter, parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+}
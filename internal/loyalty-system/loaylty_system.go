@@ -1,58 +1,167 @@
 package loyalty
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"github.com/go-resty/resty/v2"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
 	"go.uber.org/zap"
+	"sync"
+	"time"
 )
 
-func (ls *LoyaltySystem) UpdateOrdersInfo() error {
-	allOrders, err := ls.db.GetAllOrders()
+const (
+	claimLease            = time.Minute
+	recheckInterval       = 5 * time.Second
+	notRegisteredInterval = 30 * time.Second
+	breakerThreshold      = 5
+	breakerCooldown       = 30 * time.Second
+)
+
+var retryBackoff = backoff{base: time.Second, max: 10 * time.Minute}
+
+func (ls *LoyaltySystem) Start() {
+	for i := 0; i < ls.workers; i++ {
+		ls.wg.Add(1)
+		go func() {
+			defer ls.wg.Done()
+			for job := range ls.jobs {
+				if err := ls.processOrder(job); err != nil {
+					ls.log.Errorf("error while processing order %q: %s", job.OrderID, err.Error())
+				}
+			}
+		}()
+	}
+}
+
+func (ls *LoyaltySystem) Stop() {
+	close(ls.jobs)
+	ls.wg.Wait()
+}
+
+func (ls *LoyaltySystem) UpdateOrdersInfo(ctx context.Context) error {
+	if ls.breaker.RetryIn() > 0 || ls.breaker.Throttle().Throttled {
+		return nil
+	}
+	pendingOrders, err := ls.db.ClaimOrders(ls.workers, ls.lease)
 	if err != nil {
-		return fmt.Errorf("error while getting all orders from db for updating info: %w", err)
+		return fmt.Errorf("error while claiming orders from accrual queue: %w", err)
 	}
-	for _, o := range allOrders {
-		actualInfo, err := ls.getActualInfo(o)
-		if err != nil {
-			return fmt.Errorf("error while getting actual info for order %q: %w", o, err)
+	for _, o := range pendingOrders {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ls.jobs <- o:
 		}
-		if err = ls.db.UpdateOrderInfo(actualInfo); err != nil {
-			return fmt.Errorf("error while updating order info: %w", err)
-		}
-		ls.log.Infof("order %q updated with accrual: %f", *actualInfo.Order, actualInfo.Accrual)
 	}
 	return nil
 }
 
-func (ls *LoyaltySystem) getActualInfo(orderID string) (*models.OrderInfo, error) {
-	orderFromSystem, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/%s", ls.addr, orderID))
+func (ls *LoyaltySystem) Health() models.AccrualHealth {
+	return models.AccrualHealth{
+		Circuit:  ls.breaker.State(),
+		Throttle: ls.breaker.Throttle(),
+	}
+}
+
+func (ls *LoyaltySystem) processOrder(job models.AccrualJob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ls.requestTimeout)
+	defer cancel()
+
+	accrualInfo, err := ls.breaker.GetOrderInfo(ctx, job.OrderID)
+	if err != nil {
+		if !errors.Is(err, ErrOrderNotRegistered) && !errors.Is(err, ErrCircuitOpen) && !errors.As(err, &ErrThrottled{}) {
+			ls.log.Errorf("error while getting actual info for order %q: %s", job.OrderID, err.Error())
+		}
+		return ls.reschedule(job, err)
+	}
+	status, err := accrualInfo.Status.OrderStatus()
 	if err != nil {
-		return nil, fmt.Errorf("error while requesting for order %q: %w", orderID, err)
+		ls.log.Errorf("error while mapping accrual status for order %q: %s", job.OrderID, err.Error())
+		return ls.reschedule(job, err)
 	}
-	var info models.OrderInfo
-	if err = json.Unmarshal(orderFromSystem.Body(), &info); err != nil {
-		return nil, fmt.Errorf("error while unmarshalling order body: %w", err)
+	actualInfo := &models.OrderInfo{
+		Order:   &job.OrderID,
+		Status:  status,
+		Accrual: accrualInfo.Accrual,
 	}
-	return &info, nil
+	if err = ls.db.UpdateOrderInfo(actualInfo, recheckInterval); err != nil {
+		if errors.Is(err, models.ErrIllegalTransition) {
+			ls.log.Errorf("rejected accrual update for order %q: %s", job.OrderID, err.Error())
+			return ls.reschedule(job, err)
+		}
+		return fmt.Errorf("error while updating order info: %w", err)
+	}
+	ls.log.Infof("order %q updated with status %s and accrual: %s", job.OrderID, status, actualInfo.Accrual)
+	return nil
+}
+
+func (ls *LoyaltySystem) reschedule(job models.AccrualJob, reason error) error {
+	if err := ls.db.RescheduleOrder(job.OrderID, ls.retryDelay(job, reason), reason); err != nil {
+		return fmt.Errorf("error while rescheduling order: %w", err)
+	}
+	return nil
+}
+
+func (ls *LoyaltySystem) retryDelay(job models.AccrualJob, err error) time.Duration {
+	var throttled ErrThrottled
+	switch {
+	case errors.Is(err, ErrOrderNotRegistered):
+		return notRegisteredInterval
+	case errors.Is(err, ErrCircuitOpen):
+		if retryIn := ls.breaker.RetryIn(); retryIn > retryBackoff.base {
+			return retryIn
+		}
+		return retryBackoff.base
+	case errors.As(err, &throttled):
+		return time.Until(throttled.Until)
+	case errors.Is(err, ErrTooManyRequests):
+		if throttle := ls.breaker.Throttle(); throttle.PausedUntil != nil {
+			return time.Until(*throttle.PausedUntil)
+		}
+	}
+	return retryBackoff.delay(job.Attempts)
 }
 
-func New(addr string, db dbManager, logger *zap.SugaredLogger) *LoyaltySystem {
+func New(client AccrualClient, workers int, requestTimeout time.Duration, db dbManager, logger *zap.SugaredLogger) *LoyaltySystem {
+	if workers < 1 {
+		workers = 1
+	}
+	// a job may wait for a worker busy with the previous batch before its own request starts
+	lease := claimLease
+	if 2*requestTimeout > lease {
+		lease = 2 * requestTimeout
+	}
 	return &LoyaltySystem{
-		addr: addr,
-		db:   db,
-		log:  logger,
+		breaker:        NewCircuitBreaker(client, breakerThreshold, breakerCooldown, logger),
+		db:             db,
+		log:            logger,
+		workers:        workers,
+		requestTimeout: requestTimeout,
+		lease:          lease,
+		jobs:           make(chan models.AccrualJob),
 	}
 }
 
 type LoyaltySystem struct {
-	addr string
-	db   dbManager
-	log  *zap.SugaredLogger
+	breaker        *CircuitBreaker
+	db             dbManager
+	log            *zap.SugaredLogger
+	workers        int
+	requestTimeout time.Duration
+	lease          time.Duration
+	jobs           chan models.AccrualJob
+	wg             sync.WaitGroup
+}
+
+type AccrualClient interface {
+	GetOrderInfo(ctx context.Context, orderID string) (*models.AccrualInfo, error)
+	Throttle() models.ThrottleState
 }
 
+//go:generate mockery --disable-version-string --filename db_mock.go --inpackage --name dbManager
 type dbManager interface {
-	GetAllOrders() ([]string, error)
-	UpdateOrderInfo(orderInfo *models.OrderInfo) error
+	ClaimOrders(limit int, lease time.Duration) ([]models.AccrualJob, error)
+	RescheduleOrder(orderID string, delay time.Duration, reason error) error
+	UpdateOrderInfo(orderInfo *models.OrderInfo, recheckAfter time.Duration) error
 }
@@ -0,0 +1,160 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	accrualfake "github.com/kontik-pk/go-musthave-diploma-tpl/internal/accrual-fake"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoyaltySystem_UpdateOrdersInfo(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Sync()
+
+	t.Run("failed order does not block the others", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orderID := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+			if orderID == "2" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(fmt.Sprintf(`{"order":%q,"status":"PROCESSED","accrual":100}`, orderID)))
+		}))
+		defer srv.Close()
+
+		manager := newMockDbManager(t)
+		manager.On("ClaimOrders", 3, claimLease).Return(jobs("1", "2", "3"), nil)
+		manager.On("RescheduleOrder", "2", mock.AnythingOfType("time.Duration"), mock.Anything).Return(nil)
+		manager.On("UpdateOrderInfo", mock.MatchedBy(func(info *models.OrderInfo) bool {
+			return *info.Order != "2" && info.Status == models.OrderStatusProcessed
+		}), recheckInterval).Return(nil).Twice()
+
+		ls := New(NewHTTPClient(srv.URL, logger.Sugar()), 3, time.Second, manager, logger.Sugar())
+		ls.Start()
+		err := ls.UpdateOrdersInfo(context.Background())
+		ls.Stop()
+		assert.NoError(t, err)
+	})
+
+	t.Run("accrual statuses are mapped to order statuses", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimPrefix(r.URL.Path, "/api/orders/") {
+			case "1":
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"order":"1","status":"REGISTERED"}`))
+			case "2":
+				w.WriteHeader(http.StatusNoContent)
+			case "3":
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"order":"3","status":"UNKNOWN"}`))
+			}
+		}))
+		defer srv.Close()
+
+		manager := newMockDbManager(t)
+		manager.On("ClaimOrders", 3, claimLease).Return(jobs("1", "2", "3"), nil)
+		manager.On("UpdateOrderInfo", mock.MatchedBy(func(info *models.OrderInfo) bool {
+			return *info.Order == "1" && info.Status == models.OrderStatusProcessing
+		}), recheckInterval).Return(nil).Once()
+		manager.On("RescheduleOrder", "2", notRegisteredInterval, ErrOrderNotRegistered).Return(nil).Once()
+		manager.On("RescheduleOrder", "3", mock.AnythingOfType("time.Duration"), mock.MatchedBy(func(err error) bool {
+			return errors.Is(err, models.ErrUnknownAccrualStatus)
+		})).Return(nil).Once()
+
+		ls := New(NewHTTPClient(srv.URL, logger.Sugar()), 3, time.Second, manager, logger.Sugar())
+		ls.Start()
+		err := ls.UpdateOrdersInfo(context.Background())
+		ls.Stop()
+		assert.NoError(t, err)
+	})
+
+	t.Run("fake accrual system", func(t *testing.T) {
+		srv := httptest.NewServer(accrualfake.New(accrualfake.Scenario{
+			Progression: []models.AccrualStatus{models.AccrualStatusProcessed},
+			Rules: []accrualfake.Rule{
+				{Prefix: "1", Accrual: 50000},
+				{Prefix: "9", Status: models.AccrualStatusInvalid},
+			},
+		}))
+		defer srv.Close()
+
+		manager := newMockDbManager(t)
+		manager.On("ClaimOrders", 2, claimLease).Return(jobs("12345678903", "9278923470"), nil)
+		manager.On("UpdateOrderInfo", mock.MatchedBy(func(info *models.OrderInfo) bool {
+			return *info.Order == "12345678903" && info.Status == models.OrderStatusProcessed && info.Accrual == 50000
+		}), recheckInterval).Return(nil).Once()
+		manager.On("UpdateOrderInfo", mock.MatchedBy(func(info *models.OrderInfo) bool {
+			return *info.Order == "9278923470" && info.Status == models.OrderStatusInvalid && info.Accrual == 0
+		}), recheckInterval).Return(nil).Once()
+
+		ls := New(NewHTTPClient(srv.URL, logger.Sugar()), 2, time.Second, manager, logger.Sugar())
+		ls.Start()
+		err := ls.UpdateOrdersInfo(context.Background())
+		ls.Stop()
+		assert.NoError(t, err)
+	})
+
+	t.Run("throttled orders are rescheduled at the end of the pause", func(t *testing.T) {
+		manager := newMockDbManager(t)
+		manager.On("ClaimOrders", 6, claimLease).Return(jobs("1", "2", "3", "4", "5", "6"), nil)
+		manager.On("RescheduleOrder", mock.Anything, mock.MatchedBy(func(delay time.Duration) bool {
+			return delay > 55*time.Second && delay <= time.Minute
+		}), mock.Anything).Return(nil).Times(6)
+
+		ls := New(&stubClient{err: ErrThrottled{Until: time.Now().Add(time.Minute)}}, 6, time.Second, manager, logger.Sugar())
+		ls.Start()
+		err := ls.UpdateOrdersInfo(context.Background())
+		ls.Stop()
+		assert.NoError(t, err)
+		assert.Equal(t, models.CircuitClosed, ls.Health().Circuit)
+	})
+
+	t.Run("lease covers a worker busy with the previous batch", func(t *testing.T) {
+		manager := newMockDbManager(t)
+		manager.On("ClaimOrders", 1, 3*time.Minute).Return(nil, nil)
+
+		ls := New(NewHTTPClient("http://localhost", logger.Sugar()), 1, 90*time.Second, manager, logger.Sugar())
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+	})
+
+	t.Run("nothing is claimed while the accrual system is throttled", func(t *testing.T) {
+		client := NewHTTPClient("http://localhost", logger.Sugar())
+		client.throttle("60", "")
+
+		ls := New(client, 1, time.Second, newMockDbManager(t), logger.Sugar())
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+	})
+
+	t.Run("cancelled context stops dispatching", func(t *testing.T) {
+		manager := newMockDbManager(t)
+		manager.On("ClaimOrders", 2, claimLease).Return(jobs("1", "2"), nil)
+
+		ls := New(NewHTTPClient("http://localhost", logger.Sugar()), 2, time.Second, manager, logger.Sugar())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := ls.UpdateOrdersInfo(ctx)
+		ls.Stop()
+		assert.NoError(t, err)
+	})
+}
+
+func jobs(orderIDs ...string) []models.AccrualJob {
+	result := make([]models.AccrualJob, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		result = append(result, models.AccrualJob{OrderID: orderID, Attempts: 1})
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var Roles = []string{RoleUser, RoleAdmin}
+
+func IsKnownRole(role string) bool {
+	for _, known := range Roles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type UserInfo struct {
+	Login            string      `json:"login"`
+	Roles            []string    `json:"roles"`
+	BlockedAt        *time.Time  `json:"blocked_at,omitempty"`
+	TwoFactorEnabled bool        `json:"two_factor_enabled"`
+	Balance          BalanceInfo `json:"balance"`
+}
+
+type AuditEntry struct {
+	Actor  string
+	Action string
+	Target string
+	Status int
+	IP     string
+}
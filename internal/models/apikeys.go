@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+const (
+	ScopeOrdersRead      = "orders:read"
+	ScopeOrdersWrite     = "orders:write"
+	ScopeBalanceRead     = "balance:read"
+	ScopeBalanceWithdraw = "balance:withdraw"
+	ScopeWithdrawalsRead = "withdrawals:read"
+)
+
+var Scopes = []string{ScopeOrdersRead, ScopeOrdersWrite, ScopeBalanceRead, ScopeBalanceWithdraw, ScopeWithdrawalsRead}
+
+func IsKnownScope(scope string) bool {
+	for _, known := range Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope is always true for a user session: scopes only narrow down what an API key may do.
+func (p Principal) HasScope(scope string) bool {
+	if p.APIKeyID == "" {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type APIKey struct {
+	ID         string     `json:"id"`
+	Login      string     `json:"-"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// Key is only returned when the key is created.
+	Key string `json:"key,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// LockoutPolicy allows FreeAttempts failures within Window, then locks the subject
+// for BaseDelay, doubling with every further failure up to MaxDelay.
+type LockoutPolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	policy := LockoutPolicy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Window: time.Minute}
+	expected := []time.Duration{0, 0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for failures, delay := range expected {
+		assert.Equal(t, delay, policy.Delay(failures), "failures: %d", failures)
+	}
+}
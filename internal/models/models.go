@@ -1,10 +1,18 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v4"
 	"time"
 )
 
+var (
+	ErrUnknownAccrualStatus = errors.New("unknown accrual status")
+	ErrIllegalTransition    = errors.New("illegal order status transition")
+)
+
 type User struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
@@ -12,32 +20,184 @@ type User struct {
 
 type OrderStatus string
 
+const (
+	OrderStatusNew        OrderStatus = "NEW"
+	OrderStatusProcessing OrderStatus = "PROCESSING"
+	OrderStatusInvalid    OrderStatus = "INVALID"
+	OrderStatusProcessed  OrderStatus = "PROCESSED"
+)
+
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusNew:        {OrderStatusNew, OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed},
+	OrderStatusProcessing: {OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed},
+	OrderStatusInvalid:    {},
+	OrderStatusProcessed:  {},
+}
+
+func (s OrderStatus) IsFinal() bool {
+	return s == OrderStatusInvalid || s == OrderStatusProcessed
+}
+
+func (s OrderStatus) TransitionTo(next OrderStatus) error {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, s, next)
+}
+
+type AccrualStatus string
+
+const (
+	AccrualStatusRegistered AccrualStatus = "REGISTERED"
+	AccrualStatusProcessing AccrualStatus = "PROCESSING"
+	AccrualStatusInvalid    AccrualStatus = "INVALID"
+	AccrualStatusProcessed  AccrualStatus = "PROCESSED"
+)
+
+func (s AccrualStatus) OrderStatus() (OrderStatus, error) {
+	switch s {
+	case AccrualStatusRegistered, AccrualStatusProcessing:
+		return OrderStatusProcessing, nil
+	case AccrualStatusInvalid:
+		return OrderStatusInvalid, nil
+	case AccrualStatusProcessed:
+		return OrderStatusProcessed, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownAccrualStatus, s)
+	}
+}
+
 type OrderInfo struct {
 	UserName  *string     `json:"user,omitempty"`
 	OrderID   string      `json:"number"`
 	Order     *string     `json:"order,omitempty"`
 	CreatedAt *time.Time  `json:"uploaded_at,omitempty"`
 	Status    OrderStatus `json:"status"`
-	Accrual   float64     `json:"accrual"`
+	Accrual   Money       `json:"accrual"`
+}
+
+type AccrualInfo struct {
+	Order   string        `json:"order"`
+	Status  AccrualStatus `json:"status"`
+	Accrual Money         `json:"accrual,omitempty"`
+}
+
+// UnmarshalJSON rounds the accrual to kopecks: rejecting a reply with finer precision
+// would only get the order rescheduled again and again.
+func (a *AccrualInfo) UnmarshalJSON(data []byte) error {
+	type accrualInfo AccrualInfo
+	var raw struct {
+		accrualInfo
+		Accrual json.RawMessage `json:"accrual,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*a = AccrualInfo(raw.accrualInfo)
+	if len(raw.Accrual) == 0 || string(raw.Accrual) == "null" {
+		return nil
+	}
+	accrual, err := ParseMoneyRounded(string(raw.Accrual))
+	if err != nil {
+		return err
+	}
+	a.Accrual = accrual
+	return nil
+}
+
+type AccrualJob struct {
+	OrderID  string
+	Attempts int
+}
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type AccrualHealth struct {
+	Circuit  CircuitState  `json:"circuit"`
+	Throttle ThrottleState `json:"throttle"`
 }
 
 type WithdrawInfo struct {
 	UserName    *string    `json:"user,omitempty"`
 	OrderID     string     `json:"order"`
 	ProcessedAt *time.Time `json:"processed_at,omitempty"`
-	Amount      float64    `json:"sum"`
+	Amount      Money      `json:"sum"`
 }
 
 type BalanceInfo struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   Money `json:"current"`
+	Withdrawn Money `json:"withdrawn"`
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
 }
 
 type Claims struct {
-	Username string `json:"username"`
+	Username  string   `json:"username"`
+	SessionID string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Principal is either a user session or an API key acting on behalf of its owner.
+type Principal struct {
+	Login     string
+	SessionID string
+	Roles     []string
+	APIKeyID  string
+	Scopes    []string
+}
+
+type Session struct {
+	ID        string
+	Login     string
+	ExpiresAt time.Time
+}
+
+// LoginRequest is the body of both login steps: the credentials, and then, when two-factor
+// authentication is enabled, the challenge token with a totp or recovery code.
+type LoginRequest struct {
+	User
+	MFAToken string `json:"mfa_token,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+type LoginChallenge struct {
+	MFAToken  string `json:"mfa_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+type TOTP struct {
+	Secret    string
+	Confirmed bool
+}
+
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
 type Credentials struct {
 	Password string `json:"password"`
 	Username string `json:"login"`
@@ -52,7 +212,42 @@ type Config struct {
 	Database struct {
 		ConnectionString string
 	}
+	Compression struct {
+		MinSize      int
+		ContentTypes string
+	}
 	AccrualSystem struct {
-		Address string
+		Address        string
+		Workers        int
+		RequestTimeout time.Duration
 	}
+	Auth struct {
+		KeysFile          string
+		Keys              string
+		PasswordMinLength int
+		PasswordDenyList  string
+		// QueryTokenParam names the query parameter accepted as an access token, disabled when empty.
+		QueryTokenParam string
+		PasswordHash    struct {
+			Algorithm string
+			// Argon2Memory is in KiB.
+			Argon2Memory      uint
+			Argon2Iterations  uint
+			Argon2Parallelism uint
+			BcryptCost        int
+		}
+		OIDC struct {
+			Issuer       string
+			ClientID     string
+			ClientSecret string
+			RedirectURL  string
+			Scopes       string
+		}
+	}
+}
+
+type ThrottleState struct {
+	Throttled         bool       `json:"throttled"`
+	PausedUntil       *time.Time `json:"paused_until,omitempty"`
+	RequestsPerMinute int        `json:"requests_per_minute,omitempty"`
 }
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOrderStatus_TransitionTo(t *testing.T) {
+	testCases := []struct {
+		name    string
+		from    OrderStatus
+		to      OrderStatus
+		allowed bool
+	}{
+		{name: "new to processing", from: OrderStatusNew, to: OrderStatusProcessing, allowed: true},
+		{name: "new to processed", from: OrderStatusNew, to: OrderStatusProcessed, allowed: true},
+		{name: "processing to processing", from: OrderStatusProcessing, to: OrderStatusProcessing, allowed: true},
+		{name: "processing to invalid", from: OrderStatusProcessing, to: OrderStatusInvalid, allowed: true},
+		{name: "processing to new", from: OrderStatusProcessing, to: OrderStatusNew},
+		{name: "processed to processing", from: OrderStatusProcessed, to: OrderStatusProcessing},
+		{name: "invalid to processed", from: OrderStatusInvalid, to: OrderStatusProcessed},
+		{name: "unknown to new", from: OrderStatus("UNKNOWN"), to: OrderStatusNew},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.from.TransitionTo(tt.to)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrIllegalTransition)
+			}
+		})
+	}
+}
+
+func TestAccrualStatus_OrderStatus(t *testing.T) {
+	testCases := []struct {
+		accrual  AccrualStatus
+		expected OrderStatus
+		err      error
+	}{
+		{accrual: AccrualStatusRegistered, expected: OrderStatusProcessing},
+		{accrual: AccrualStatusProcessing, expected: OrderStatusProcessing},
+		{accrual: AccrualStatusInvalid, expected: OrderStatusInvalid},
+		{accrual: AccrualStatusProcessed, expected: OrderStatusProcessed},
+		{accrual: AccrualStatus("NEW"), err: ErrUnknownAccrualStatus},
+	}
+	for _, tt := range testCases {
+		t.Run(string(tt.accrual), func(t *testing.T) {
+			status, err := tt.accrual.OrderStatus()
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.expected, status)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+)
+
+var (
+	ErrInvalidMoney = errors.New("invalid money amount")
+	moneyPattern    = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][+-]?\d{1,3})?$`)
+)
+
+type Money int64
+
+// ParseMoney accepts JSON number literals, exponent form included, with at most kopeck precision.
+// Exponents are limited to three digits so a literal like 1e999999999 cannot blow up big.Rat.
+func ParseMoney(s string) (Money, error) {
+	kopecks, err := parseKopecks(s)
+	if err != nil {
+		return 0, err
+	}
+	if !kopecks.IsInt() || !kopecks.Num().IsInt64() {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	return Money(kopecks.Num().Int64()), nil
+}
+
+// ParseMoneyRounded is ParseMoney for amounts we do not control: finer precision is rounded
+// to kopecks, half away from zero.
+func ParseMoneyRounded(s string) (Money, error) {
+	kopecks, err := parseKopecks(s)
+	if err != nil {
+		return 0, err
+	}
+	quo, rem := new(big.Int).QuoRem(kopecks.Num(), kopecks.Denom(), new(big.Int))
+	if rem.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(kopecks.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(rem.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	return Money(quo.Int64()), nil
+}
+
+func parseKopecks(s string) (*big.Rat, error) {
+	if !moneyPattern.MatchString(s) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	amount, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	return amount.Mul(amount, big.NewRat(100, 1)), nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	kopecks := int64(m)
+	if kopecks < 0 {
+		sign = "-"
+		kopecks = -kopecks
+	}
+	rubles, fraction := kopecks/100, kopecks%100
+	switch {
+	case fraction == 0:
+		return fmt.Sprintf("%s%d", sign, rubles)
+	case fraction%10 == 0:
+		return fmt.Sprintf("%s%d.%d", sign, rubles, fraction/10)
+	default:
+		return fmt.Sprintf("%s%d.%02d", sign, rubles, fraction)
+	}
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if value == "null" {
+		return nil
+	}
+	parsed, err := ParseMoney(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = Money(math.Round(v * 100))
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidMoney, src)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMoney_JSON(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected Money
+		output   string
+		err      bool
+	}{
+		{input: `500`, expected: 50000, output: `500`},
+		{input: `751.5`, expected: 75150, output: `751.5`},
+		{input: `0.01`, expected: 1, output: `0.01`},
+		{input: `-3.05`, expected: -305, output: `-3.05`},
+		{input: `20.000000`, expected: 2000, output: `20`},
+		{input: `0.001`, err: true},
+		{input: `"42.10"`, err: true},
+		{input: `1e2`, expected: 10000, output: `100`},
+		{input: `5.5E1`, expected: 5500, output: `55`},
+		{input: `1.25e-2`, err: true},
+		{input: `2.5E-1`, expected: 25, output: `0.25`},
+		{input: `1E+3`, expected: 100000, output: `1000`},
+		{input: `1e1000`, err: true},
+		{input: `"1/2"`, err: true},
+		{input: `"abc"`, err: true},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			var m Money
+			err := json.Unmarshal([]byte(tt.input), &m)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrInvalidMoney)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, m)
+			output, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.output, string(output))
+		})
+	}
+}
+
+func TestMoney_Sum(t *testing.T) {
+	var a, b Money
+	assert.NoError(t, json.Unmarshal([]byte(`0.1`), &a))
+	assert.NoError(t, json.Unmarshal([]byte(`0.2`), &b))
+	assert.Equal(t, "0.3", (a + b).String())
+}
+
+func TestParseMoneyRounded(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected Money
+		err      bool
+	}{
+		{input: "10.005", expected: 1001},
+		{input: "10.0049", expected: 1000},
+		{input: "-10.005", expected: -1001},
+		{input: "729.98", expected: 72998},
+		{input: "1e2", expected: 10000},
+		{input: "1.00005E1", expected: 1000},
+		{input: "0x10", err: true},
+		{input: "1/2", err: true},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := ParseMoneyRounded(tt.input)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrInvalidMoney)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, m)
+		})
+	}
+}
+
+func TestMoney_Scan(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      interface{}
+		expected Money
+	}{
+		{name: "numeric as string", src: "100.50", expected: 10050},
+		{name: "numeric as bytes", src: []byte("0.30"), expected: 30},
+		{name: "float", src: 0.1 + 0.2, expected: 30},
+		{name: "integer", src: int64(7), expected: 700},
+		{name: "null", src: nil, expected: 0},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			assert.NoError(t, m.Scan(tt.src))
+			assert.Equal(t, tt.expected, m)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+// Identity is a user as the OpenID Connect provider knows them: issuer and subject are the only
+// stable identifiers, the rest is profile data that may change.
+type Identity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+// OIDCLogin is a pending authorization code flow. LinkLogin is set when a signed-in user
+// links an identity instead of logging in with it.
+type OIDCLogin struct {
+	CodeVerifier string
+	Nonce        string
+	LinkLogin    string
+}
+
+type OIDCAuthorization struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
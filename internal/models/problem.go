@@ -0,0 +1,10 @@
+package models
+
+// Problem is an error response body in the RFC 7807 form, extended with a machine-readable code.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+}
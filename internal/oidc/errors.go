@@ -0,0 +1,13 @@
+package oidc
+
+import "errors"
+
+var (
+	ErrDiscovery       = errors.New("error while discovering openid provider")
+	ErrTokenExchange   = errors.New("authorization code exchange failed")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+	ErrUnknownKey      = errors.New("id token is signed with an unknown key")
+	ErrUnsupportedKey  = errors.New("unsupported json web key")
+	ErrNonceMismatch   = errors.New("id token nonce does not match")
+	ErrMissingEndpoint = errors.New("openid provider metadata misses an endpoint")
+)
@@ -0,0 +1,266 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryPath  = "/.well-known/openid-configuration"
+	requestTimeout = 10 * time.Second
+	// keysRefreshInterval limits how often tokens with an unknown kid make us refetch the keys,
+	// so forged tokens cannot be used to flood the provider.
+	keysRefreshInterval = time.Minute
+	clockSkew           = time.Minute
+)
+
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+type idTokenClaims struct {
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// Provider is an OpenID Connect relying party for the authorization code flow with PKCE.
+type Provider struct {
+	config   Config
+	metadata metadata
+	client   *resty.Client
+
+	mu            sync.Mutex
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// New discovers the provider metadata and fetches its signing keys.
+func New(ctx context.Context, config Config) (*Provider, error) {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+	if !contains(config.Scopes, "openid") {
+		config.Scopes = append([]string{"openid"}, config.Scopes...)
+	}
+	p := &Provider{
+		config: config,
+		client: resty.New().SetTimeout(requestTimeout),
+	}
+	response, err := p.client.R().SetContext(ctx).Get(config.Issuer + discoveryPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status code %d", ErrDiscovery, response.StatusCode())
+	}
+	if err = json.Unmarshal(response.Body(), &p.metadata); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	if p.metadata.Issuer != config.Issuer {
+		return nil, fmt.Errorf("%w: metadata is issued by %q instead of %q", ErrDiscovery, p.metadata.Issuer, config.Issuer)
+	}
+	if p.metadata.AuthorizationEndpoint == "" || p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "" {
+		return nil, ErrMissingEndpoint
+	}
+	if len(p.metadata.CodeChallengeMethods) > 0 && !contains(p.metadata.CodeChallengeMethods, "S256") {
+		return nil, fmt.Errorf("%w: provider does not support S256 code challenges", ErrDiscovery)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err = p.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Provider) Issuer() string {
+	return p.metadata.Issuer
+}
+
+func (p *Provider) AuthCodeURL(state string, nonce string, codeChallenge string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange redeems the authorization code and returns the identity from the verified id token.
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (models.Identity, error) {
+	request := p.client.R().SetContext(ctx).SetFormData(map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          code,
+		"redirect_uri":  p.config.RedirectURL,
+		"code_verifier": codeVerifier,
+		"client_id":     p.config.ClientID,
+	})
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	response, err := request.Post(p.metadata.TokenEndpoint)
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("error while exchanging authorization code: %w", err)
+	}
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(response.Body(), &tokens)
+	if response.StatusCode() != http.StatusOK {
+		return models.Identity{}, fmt.Errorf("%w: status %d: %s %s", ErrTokenExchange, response.StatusCode(), tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return models.Identity{}, fmt.Errorf("%w: response has no id token", ErrTokenExchange)
+	}
+	return p.verifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, idToken string, nonce string) (models.Identity, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		// Time claims are checked below, with an allowance for clock skew.
+		jwt.WithoutClaimsValidation(),
+	)
+	var claims idTokenClaims
+	if _, err := parser.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	}); err != nil {
+		return models.Identity{}, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.metadata.Issuer:
+		return models.Identity{}, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.VerifyAudience(p.config.ClientID, true):
+		return models.Identity{}, fmt.Errorf("%w: issued for %v", ErrInvalidIDToken, claims.Audience)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+		return models.Identity{}, fmt.Errorf("%w: authorized party is %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	case claims.ExpiresAt == nil || now.After(claims.ExpiresAt.Add(clockSkew)):
+		return models.Identity{}, fmt.Errorf("%w: token is expired", ErrInvalidIDToken)
+	case claims.IssuedAt != nil && claims.IssuedAt.After(now.Add(clockSkew)):
+		return models.Identity{}, fmt.Errorf("%w: token is issued in the future", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return models.Identity{}, fmt.Errorf("%w: token has no subject", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return models.Identity{}, ErrNonceMismatch
+	}
+	return models.Identity{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// key refetches the provider keys when the token is signed with an unknown one: providers
+// publish new keys ahead of rotation, so a cached set is eventually outdated.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if err := p.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// lookupKey accepts a token without kid only when the provider publishes a single key.
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) error {
+	p.keysFetchedAt = time.Now()
+	response, err := p.client.R().SetContext(ctx).Get(p.metadata.JWKSURI)
+	if err != nil {
+		return fmt.Errorf("error while fetching provider keys: %w", err)
+	}
+	if response.StatusCode() != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d while fetching provider keys", response.StatusCode())
+	}
+	var set jwkSet
+	if err = json.Unmarshal(response.Body(), &set); err != nil {
+		return fmt.Errorf("error while unmarshalling provider keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped: the provider may publish them for other clients.
+		if key, err := k.publicKey(); err == nil {
+			keys[k.KeyID] = key
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: provider publishes no usable signing keys", ErrUnsupportedKey)
+	}
+	p.keys = keys
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
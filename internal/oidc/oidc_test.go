@@ -0,0 +1,155 @@
+package oidc
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testRedirectURL = "http://gophermart.test/api/user/oidc/callback"
+
+// authorize follows the authorization url up to the redirect back to us and returns the code.
+func authorize(t *testing.T, authURL string, state string) string {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusFound, response.StatusCode)
+	callback, err := url.Parse(response.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, state, callback.Query().Get("state"))
+	return callback.Query().Get("code")
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	idp := oidctest.NewServer("gophermart", "client-secret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "248289761001", Email: "jane@example.com", EmailVerified: true, PreferredUsername: "jane"})
+
+	testCases := []struct {
+		name             string
+		clientSecret     string
+		tamper           func(claims jwt.MapClaims)
+		spoilVerifier    bool
+		nonce            string
+		expectedError    error
+		expectedIdentity models.Identity
+	}{
+		{
+			name:         "positive: identity from id token",
+			clientSecret: "client-secret",
+			expectedIdentity: models.Identity{
+				Issuer:            idp.URL,
+				Subject:           "248289761001",
+				Email:             "jane@example.com",
+				EmailVerified:     true,
+				PreferredUsername: "jane",
+			},
+		},
+		{
+			name:          "negative: wrong client secret",
+			clientSecret:  "other-secret",
+			expectedError: ErrTokenExchange,
+		},
+		{
+			name:          "negative: code verifier does not match the challenge",
+			clientSecret:  "client-secret",
+			spoilVerifier: true,
+			expectedError: ErrTokenExchange,
+		},
+		{
+			name:          "negative: nonce of another login",
+			clientSecret:  "client-secret",
+			nonce:         "other-nonce",
+			expectedError: ErrNonceMismatch,
+		},
+		{
+			name:          "negative: token for another client",
+			clientSecret:  "client-secret",
+			tamper:        func(claims jwt.MapClaims) { claims["aud"] = "other-client" },
+			expectedError: ErrInvalidIDToken,
+		},
+		{
+			name:          "negative: token from another issuer",
+			clientSecret:  "client-secret",
+			tamper:        func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+			expectedError: ErrInvalidIDToken,
+		},
+		{
+			name:         "negative: expired token",
+			clientSecret: "client-secret",
+			tamper: func(claims jwt.MapClaims) {
+				claims["exp"] = time.Now().Add(-2 * clockSkew).Unix()
+			},
+			expectedError: ErrInvalidIDToken,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.TamperClaims = tt.tamper
+			provider, err := New(context.Background(), Config{
+				Issuer:       idp.URL,
+				ClientID:     "gophermart",
+				ClientSecret: tt.clientSecret,
+				RedirectURL:  testRedirectURL,
+			})
+			require.NoError(t, err)
+
+			verifier, challenge, err := NewPKCE()
+			require.NoError(t, err)
+			code := authorize(t, provider.AuthCodeURL("state-1", "nonce-1", challenge), "state-1")
+			if tt.spoilVerifier {
+				verifier += "x"
+			}
+			nonce := "nonce-1"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			identity, err := provider.Exchange(context.Background(), code, verifier, nonce)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedIdentity, identity)
+		})
+	}
+}
+
+func TestProvider_UnknownKey(t *testing.T) {
+	idp := oidctest.NewServer("gophermart", "")
+	defer idp.Close()
+	provider, err := New(context.Background(), Config{Issuer: idp.URL + "/", ClientID: "gophermart", RedirectURL: testRedirectURL})
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": idp.URL, "aud": "gophermart", "sub": "1"})
+	token.Header["kid"] = "rotated-out"
+	idToken, err := token.SignedString(idp.Key())
+	require.NoError(t, err)
+	_, err = provider.verifyIDToken(context.Background(), idToken, "")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestNew_Discovery(t *testing.T) {
+	idp := oidctest.NewServer("gophermart", "")
+	defer idp.Close()
+
+	_, err := New(context.Background(), Config{Issuer: idp.URL + "/tenant", ClientID: "gophermart"})
+	assert.ErrorIs(t, err, ErrDiscovery)
+
+	provider, err := New(context.Background(), Config{Issuer: idp.URL, ClientID: "gophermart", Scopes: []string{"email"}})
+	require.NoError(t, err)
+	authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce", "challenge"))
+	require.NoError(t, err)
+	assert.Equal(t, "openid email", authURL.Query().Get("scope"))
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+}
@@ -2,25 +2,66 @@ package router
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/auth"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/compress"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/database"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/handlers"
+	loyalty "github.com/kontik-pk/go-musthave-diploma-tpl/internal/loyalty-system"
+	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/models"
 	"go.uber.org/zap"
 )
 
-func New(dbManager *database.Manager, log *zap.SugaredLogger) *chi.Mux {
-	handler := handlers.New(dbManager, log)
+func New(dbManager *database.Manager, keys *auth.Keyring, loyaltySystem *loyalty.LoyaltySystem, compressor *compress.Compressor, log *zap.SugaredLogger, opts ...handlers.Option) *chi.Mux {
+	handler := handlers.New(dbManager, keys, log, opts...)
+	healthHandler := handlers.NewHealth(loyaltySystem, log)
 	r := chi.NewRouter()
+	r.Use(compressor.Handler)
+	r.Get("/api/health", healthHandler.GetHealth)
+	r.Get("/.well-known/jwks.json", handler.GetJWKS)
 	r.Group(func(r chi.Router) {
 		r.Post("/api/user/register", handler.Register)
 		r.Post("/api/user/login", handler.Login)
+		r.Post("/api/user/token/refresh", handler.RefreshToken)
+		r.Post("/api/user/password/reset", handler.RequestPasswordReset)
+		r.Post("/api/user/password/reset/confirm", handler.ConfirmPasswordReset)
+		r.Get("/api/user/oidc/login", handler.OIDCLogin)
+		r.Get("/api/user/oidc/callback", handler.OIDCCallback)
 	})
 	r.Group(func(r chi.Router) {
 		r.Use(handler.BasicAuth)
-		r.Post("/api/user/orders", handler.LoadOrder)
-		r.Post("/api/user/balance/withdraw", handler.Withdraw)
-		r.Get("/api/user/orders", handler.GetOrders)
-		r.Get("/api/user/withdrawals", handler.GetWithdrawals)
-		r.Get("/api/user/balance", handler.GetBalance)
+		r.Use(handler.RequireRole(models.RoleUser))
+		r.With(handler.RequireScope(models.ScopeOrdersWrite)).Post("/api/user/orders", handler.LoadOrder)
+		r.With(handler.RequireScope(models.ScopeBalanceWithdraw)).Post("/api/user/balance/withdraw", handler.Withdraw)
+		r.With(handler.RequireScope(models.ScopeOrdersRead)).Get("/api/user/orders", handler.GetOrders)
+		r.With(handler.RequireScope(models.ScopeWithdrawalsRead)).Get("/api/user/withdrawals", handler.GetWithdrawals)
+		r.With(handler.RequireScope(models.ScopeBalanceRead)).Get("/api/user/balance", handler.GetBalance)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(handler.BasicAuth)
+		r.Use(handler.RequireRole(models.RoleUser))
+		r.Use(handler.RequireSession)
+		r.Post("/api/user/logout", handler.Logout)
+		r.Post("/api/user/logout/all", handler.LogoutAll)
+		r.Post("/api/user/password", handler.ChangePassword)
+		r.Post("/api/user/2fa/enroll", handler.EnrollTwoFactor)
+		r.Post("/api/user/2fa/confirm", handler.ConfirmTwoFactor)
+		r.Delete("/api/user/2fa", handler.DisableTwoFactor)
+		r.Post("/api/user/api-keys", handler.CreateAPIKey)
+		r.Get("/api/user/api-keys", handler.ListAPIKeys)
+		r.Delete("/api/user/api-keys/{id}", handler.RevokeAPIKey)
+		r.Post("/api/user/oidc/link", handler.LinkOIDC)
+	})
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(handler.AuditAdminActions)
+		r.Use(handler.BasicAuth)
+		r.Use(handler.RequireSession)
+		r.Use(handler.RequireRole(models.RoleAdmin))
+		r.Get("/users/{login}", handler.AdminGetUser)
+		r.Get("/users/{login}/orders", handler.AdminGetUserOrders)
+		r.Get("/users/{login}/withdrawals", handler.AdminGetUserWithdrawals)
+		r.Post("/users/{login}/block", handler.AdminBlockUser)
+		r.Post("/users/{login}/unblock", handler.AdminUnblockUser)
+		r.Post("/orders/{number}/recheck", handler.AdminRecheckOrder)
 	})
 
 	return r
@@ -2,6 +2,7 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/kontik-pk/go-musthave-diploma-tpl/internal/loyalty-system"
 	"go.uber.org/zap"
@@ -27,42 +28,56 @@ func New(server *http.Server, loyaltyPointsSystem *loyalty.LoyaltySystem, log *z
 }
 
 func (r *Runner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-sig
 		r.log.Infof("Stopping server")
-		if err := r.server.Shutdown(ctx); err != nil {
+		cancel()
+		if err := r.server.Shutdown(context.Background()); err != nil {
 			r.log.Errorf("Error stopping server: %s", err)
 		}
 	}()
 
-	go r.actualizeOrdersInfo(ctx)
+	actualizeDone := make(chan struct{})
+	go func() {
+		defer close(actualizeDone)
+		r.actualizeOrdersInfo(ctx)
+	}()
 
 	r.log.Infof("Starting server on addr: %s", r.server.Addr)
-	if err := r.server.ListenAndServe(); err != nil {
+	if err := r.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		cancel()
+		<-actualizeDone
 		return fmt.Errorf("error while running server: %w", err)
 	}
+	<-shutdownDone
+	<-actualizeDone
 	return nil
 }
 
 func (r *Runner) actualizeOrdersInfo(ctx context.Context) {
 	r.log.Infof("Starting actualize orders info")
+	r.loyaltyPointsSystem.Start()
+	defer func() {
+		r.loyaltyPointsSystem.Stop()
+		r.log.Infof("Accrual workers are stopped")
+	}()
 	ticker := time.NewTicker(time.Second)
-	errorsCounter := 0
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			r.log.Infof("Stopping actualize orders info: context done")
 			return
 		case <-ticker.C:
-			if err := r.loyaltyPointsSystem.UpdateOrdersInfo(); err != nil {
+			if err := r.loyaltyPointsSystem.UpdateOrdersInfo(ctx); err != nil {
 				r.log.Errorf("error while request to loyalty system: %s", err.Error())
-				errorsCounter++
-				if errorsCounter > 10 {
-					r.log.Infof("Stopping actualize orders because of many errors")
-					return
-				}
 			}
 		}
 	}